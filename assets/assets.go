@@ -0,0 +1,9 @@
+// Embeds the default data files (blocks, biomes...), so the engine and its tests
+// work from any directory. The game reloads them from disk at startup, so they can
+// be edited without recompiling.
+package assets
+
+import "embed"
+
+//go:embed data
+var Data embed.FS
@@ -3,7 +3,6 @@ module go-engine
 go 1.24.0
 
 require (
-	github.com/aquilax/go-perlin v1.1.0
 	github.com/gen2brain/raylib-go/raygui v0.0.0-20260217065004-2c5f1b24d85e
 	github.com/gen2brain/raylib-go/raylib v0.55.1
 	golang.org/x/exp v0.0.0-20250911091902-df9299821621
@@ -17,6 +17,7 @@ void main() {
     vec3 L = normalize(-lightDir);
 
     vec3 baseColor = (colDiffuse * fragColor).rgb;
+    float alpha = (colDiffuse * fragColor).a; // below 1 for the translucent blocks
 
     float diff = max(dot(N, L), 0.2); // never less than 0.2
 
@@ -38,5 +39,5 @@ void main() {
     float fogFactor = 1.0/exp((dist*fogDensity)*(dist*fogDensity));
     fogFactor = clamp(fogFactor, 0.0, 1.0);
 
-    finalColor = mix(fogColor, vec4(litColor, 1.0), fogFactor);
+    finalColor = mix(fogColor, vec4(litColor, alpha), fogFactor);
 }
\ No newline at end of file
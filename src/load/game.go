@@ -2,12 +2,13 @@ package load
 
 import (
 	"fmt"
-	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
 
 	"go-engine/src/pkg"
 	"go-engine/src/world"
 
-	"github.com/aquilax/go-perlin"
 	gui "github.com/gen2brain/raylib-go/raygui"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
@@ -15,38 +16,37 @@ import (
 const (
 	ScreenWidth  int32 = 1000
 	ScreenHeight int32 = 480
-
-	//  Dimension of the space in which Perlin Noise is being calculated. For example, in 3D, it would be 3.
-	perlinN = int32(2)
-
-	//  Control of the intensity/amplitude of the noise
-	perlinAlpha = 3
-	//  Adjust the frequency of noise, affecting the amount of detail present in the noise by controlling the scale of the variations.
-	perlinBeta = 1.5
 )
 
 var FogCoefficient float32 = 0.0 // 0.072
 
+// Folder where the region files of each world are stored
+var SaveDir = "saves"
+
 type Game struct {
-	Camera        rl.Camera
-	CameraMode    rl.CameraMode
-	ChunkCache    *world.ChunkCache
-	Perlin1       *perlin.Perlin
-	Perlin2       *perlin.Perlin
-	Perlin3       *perlin.Perlin
-	Worley        *world.WorleyNoise
-	BiomeSelector *world.BiomeSelector
-	Shader        rl.Shader
+	Camera     rl.Camera
+	CameraMode rl.CameraMode
+	ChunkCache *world.ChunkCache
+	Generator  *world.Generator
+	Streamer   *world.Streamer // loads and generates the columns in the background
+	ChunkStats *world.ChunkStats
+	Shader     rl.Shader
 	//LightPosition rl.Vector3
 }
 
-func InitGame() Game {
+// settings are only used when the world is new, saved worlds keep their own
+func InitGame(seed int64, settings world.Settings) Game {
 	rl.SetConfigFlags(rl.FlagWindowResizable)
 	rl.InitWindow(ScreenWidth, ScreenHeight, "Protahovatsi Stroj - Voxel Game")
 
 	// Disable INFO logs, only show errors
 	rl.SetTraceLogLevel(rl.LogError)
 
+	// Data files are read from disk, so they can be changed without recompiling
+	if err := world.LoadData(os.DirFS("assets")); err != nil {
+		fmt.Printf("Failed to load the data files, using the defaults: %v\n", err)
+	}
+
 	camera := rl.Camera{
 		Position:   rl.NewVector3(2.79, 62.0, 10.0),
 		Target:     rl.NewVector3(0.0, 0.0, 0.0),
@@ -56,23 +56,16 @@ func InitGame() Game {
 	}
 	cameraMode := rl.CameraFree
 
-	// Initializes Perlin noise
-	seed1 := rand.Int63()
-	seed2 := rand.Int63()
-	seed3 := rand.Int63()
+	// Visited and edited chunks are saved per world seed
+	worldDir := filepath.Join(SaveDir, fmt.Sprint(seed))
 
-	perlin1 := perlin.NewPerlin(perlinAlpha, perlinBeta, perlinN, seed1)
-	perlin2 := perlin.NewPerlin(perlinAlpha, perlinBeta, perlinN, seed2)
-	perlin3 := perlin.NewPerlin(perlinAlpha, perlinBeta, perlinN, seed3)
-	/*
-		seed1 := rand.Int63()
-		perlin1 := perlin.NewPerlin(perlinAlpha, perlinBeta, perlinN, seed1)
-		perlin2 := perlin1
-		perlin3 := perlin2
-	*/
+	settings, err := world.LoadSettings(worldDir, settings)
+	if err != nil {
+		fmt.Printf("Failed to load the world settings, using %+v: %v\n", settings, err)
+	}
 
-	worley := world.NewWorleyNoise(seed1, 128)
-	biomeSel := world.NewBiomeSelector(seed1, 128)
+	// Initializes the noise sources of the world
+	generator := world.NewGenerator(seed, settings)
 
 	Shader := rl.LoadShader("shaders/shader.vs", "shaders/shader.fs")
 
@@ -105,11 +98,13 @@ func InitGame() Game {
 
 	chunkCache := world.NewChunkCache() // Initialize ChunkCache
 
-	// Creates the first chunk at the origin
-	originCoord := pkg.Coords{X: 0, Y: 0, Z: 0}
-	originPos := rl.NewVector3(0, 0, 0)
+	chunkCache.Store = world.NewRegionStore(worldDir)
+
+	// Counts the chunks in each state for the debug overlay
+	chunkStats := world.NewChunkStats(&chunkCache.Events)
 
-	chunkCache.Active[originCoord] = world.GenerateChunk(worley, biomeSel, originPos, perlin1, perlin2, perlin3, chunkCache, nil, false, nil, false)
+	// Creates the first column at the origin
+	chunkCache.GetColumn(generator, pkg.Coords{X: 0, Y: 0, Z: 0})
 
 	rl.SetTargetFPS(100)
 
@@ -139,15 +134,13 @@ func InitGame() Game {
 	//	Menu background style
 
 	return Game{
-		Camera:        camera,
-		CameraMode:    cameraMode,
-		ChunkCache:    chunkCache,
-		Perlin1:       perlin1,
-		Perlin2:       perlin2,
-		Perlin3:       perlin3,
-		Worley:        worley,
-		BiomeSelector: biomeSel,
-		Shader:        Shader,
+		Camera:     camera,
+		CameraMode: cameraMode,
+		ChunkCache: chunkCache,
+		Generator:  generator,
+		Streamer:   world.NewStreamer(generator, chunkCache, runtime.NumCPU()),
+		ChunkStats: chunkStats,
+		Shader:     Shader,
 		//LightPosition: LightPosition,
 	}
 }
@@ -0,0 +1,140 @@
+package lsystem
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Parameter expression, env holds the parameters of the replaced module in the order of the rule names
+type expr func(env []float64) float64
+
+// Compiles an arithmetic expression with + - * / and parentheses
+func parseExpr(s string, names []string) (expr, error) {
+	p := &exprParser{src: s, names: names}
+	e, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q in %q", p.src[p.pos:], s)
+	}
+	return e, nil
+}
+
+type exprParser struct {
+	src   string
+	pos   int
+	names []string
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) sum() (expr, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		a, b := left, right
+		if op == '+' {
+			left = func(env []float64) float64 { return a(env) + b(env) }
+		} else {
+			left = func(env []float64) float64 { return a(env) - b(env) }
+		}
+	}
+}
+
+func (p *exprParser) product() (expr, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		a, b := left, right
+		if op == '*' {
+			left = func(env []float64) float64 { return a(env) * b(env) }
+		} else {
+			left = func(env []float64) float64 { return a(env) / b(env) }
+		}
+	}
+}
+
+func (p *exprParser) factor() (expr, error) {
+	switch c := p.peek(); {
+	case c == '-':
+		p.pos++
+		inner, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return func(env []float64) float64 { return -inner(env) }, nil
+
+	case c == '(':
+		p.pos++
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' in %q", p.src)
+		}
+		p.pos++
+		return inner, nil
+
+	case c == '.' || (c >= '0' && c <= '9'):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '.' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')) {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, err
+		}
+		return func([]float64) float64 { return value }, nil
+
+	default:
+		start := p.pos
+		for p.pos < len(p.src) && strings.IndexByte("+-*/() \t", p.src[p.pos]) < 0 {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		i := slices.Index(p.names, name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown parameter %q in %q", name, p.src)
+		}
+		return func(env []float64) float64 { return env[i] }, nil
+	}
+}
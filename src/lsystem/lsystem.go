@@ -0,0 +1,323 @@
+// Package lsystem grows strings of symbols from production rules (L-systems) and draws them
+// with a 3D turtle. It knows nothing about voxels, the caller receives branches and leaves.
+//
+// Symbols can carry parameters, F(2.5) or A(l, w). Rules are written as
+//
+//	A(l,w)=F(l)[&(30)!(w*0.7)A(l*0.8,w*0.7)]/(137)A(l*0.9,w)
+//
+// where the parameters of the left side can be used in arithmetic expressions on the right side.
+// A symbol can have several rules, one of them is picked at random by its weight.
+package lsystem
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Expansion stops growing past this many modules, so a bad rule can't eat all the memory
+const MaxModules = 50000
+
+// A symbol and its parameters
+type Module struct {
+	Symbol rune
+	Params []float64
+}
+
+// Parameter with a default when the module doesn't have it
+func (m Module) Param(i int, fallback float64) float64 {
+	if i < len(m.Params) {
+		return m.Params[i]
+	}
+	return fallback
+}
+
+// A production rule. It replaces a symbol with the successor modules.
+type Rule struct {
+	Symbol    rune
+	Params    []string // names given to the parameters of the replaced module
+	Weight    float64  // chance relative to the other rules of the same symbol
+	successor []template
+}
+
+type template struct {
+	symbol rune
+	params []expr
+}
+
+// Everything needed to grow and draw a plant
+type System struct {
+	Axiom      []Module
+	Rules      []Rule
+	Iterations int
+	Angle      float64 // degrees, used by the turn commands without a parameter
+	Width      float64 // radius of the first branch
+	Length     float64 // used by F and f without a parameter
+}
+
+// Reads a rule of the form "A(x,y)=successor". The weight must be positive.
+func ParseRule(s string, weight float64) (Rule, error) {
+	left, right, ok := strings.Cut(s, "=")
+	if !ok {
+		return Rule{}, fmt.Errorf("rule %q has no '='", s)
+	}
+	if weight <= 0 {
+		return Rule{}, fmt.Errorf("rule %q: weight must be positive", s)
+	}
+
+	left = strings.TrimSpace(left)
+	symbol, rest, err := nextSymbol(left)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: %w", s, err)
+	}
+
+	rule := Rule{Symbol: symbol, Weight: weight}
+	if rest != "" {
+		args, tail, err := splitParams(rest)
+		if err != nil || strings.TrimSpace(tail) != "" {
+			return Rule{}, fmt.Errorf("rule %q: the left side must be a single symbol", s)
+		}
+		for _, arg := range args {
+			name := strings.TrimSpace(arg)
+			if !isIdent(name) {
+				return Rule{}, fmt.Errorf("rule %q: %q is not a parameter name", s, name)
+			}
+			rule.Params = append(rule.Params, name)
+		}
+	}
+
+	rule.successor, err = parseTemplates(right, rule.Params)
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: %w", s, err)
+	}
+	return rule, nil
+}
+
+// Reads a string of modules, like an axiom. Parameters can be constant expressions.
+func Parse(s string) ([]Module, error) {
+	templates, err := parseTemplates(s, nil)
+	if err != nil {
+		return nil, err
+	}
+	return instantiate(templates, nil), nil
+}
+
+// A string of modules whose parameters use variables, like the axiom "F(h)A(h*0.5)" of a tree
+// that is h blocks tall
+type Pattern struct {
+	templates []template
+	names     []string
+}
+
+func ParsePattern(s string, names ...string) (*Pattern, error) {
+	templates, err := parseTemplates(s, names)
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{templates: templates, names: names}, nil
+}
+
+// Modules with the variables replaced by values, in the order of the names
+func (p *Pattern) Modules(values ...float64) []Module {
+	env := make([]float64, len(p.names))
+	copy(env, values)
+	return instantiate(p.templates, env)
+}
+
+// Writes modules in the same form Parse reads. Parameters are rounded to 3 decimals.
+func Format(modules []Module) string {
+	var builder strings.Builder
+	for _, m := range modules {
+		builder.WriteRune(m.Symbol)
+		if len(m.Params) == 0 {
+			continue
+		}
+		builder.WriteByte('(')
+		for i, p := range m.Params {
+			if i > 0 {
+				builder.WriteByte(',')
+			}
+			builder.WriteString(strconv.FormatFloat(math.Round(p*1000)/1000, 'f', -1, 64))
+		}
+		builder.WriteByte(')')
+	}
+	return builder.String()
+}
+
+// Applies the rules Iterations times. Stochastic rules are picked with rng.
+func (s *System) Expand(rng *rand.Rand) []Module {
+	bySymbol := make(map[rune][]*Rule)
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		bySymbol[rule.Symbol] = append(bySymbol[rule.Symbol], rule)
+	}
+
+	current := s.Axiom
+	for range s.Iterations {
+		next := make([]Module, 0, len(current)*2)
+		for _, m := range current {
+			rule := pickRule(bySymbol[m.Symbol], m, rng)
+			if rule == nil {
+				next = append(next, m)
+				continue
+			}
+			next = append(next, instantiate(rule.successor, m.Params)...)
+		}
+
+		if len(next) > MaxModules {
+			break // keeps the last generation that fit
+		}
+		current = next
+	}
+	return current
+}
+
+// Rules match when they name as many parameters as the module has (or name none)
+func pickRule(rules []*Rule, m Module, rng *rand.Rand) *Rule {
+	var matching []*Rule
+	total := 0.0
+	for _, rule := range rules {
+		if len(rule.Params) == 0 || len(rule.Params) == len(m.Params) {
+			matching = append(matching, rule)
+			total += rule.Weight
+		}
+	}
+	if len(matching) <= 1 {
+		if len(matching) == 1 {
+			return matching[0]
+		}
+		return nil
+	}
+
+	r := rng.Float64() * total
+	for _, rule := range matching {
+		r -= rule.Weight
+		if r < 0 {
+			return rule
+		}
+	}
+	return matching[len(matching)-1]
+}
+
+func instantiate(templates []template, env []float64) []Module {
+	modules := make([]Module, len(templates))
+	for i, t := range templates {
+		modules[i].Symbol = t.symbol
+		if len(t.params) > 0 {
+			modules[i].Params = make([]float64, len(t.params))
+			for j, p := range t.params {
+				modules[i].Params[j] = p(env)
+			}
+		}
+	}
+	return modules
+}
+
+func parseTemplates(s string, names []string) ([]template, error) {
+	var templates []template
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		symbol, tail, err := nextSymbol(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		t := template{symbol: symbol}
+		if strings.HasPrefix(tail, "(") {
+			var args []string
+			args, tail, err = splitParams(tail)
+			if err != nil {
+				return nil, err
+			}
+			for _, arg := range args {
+				e, err := parseExpr(arg, names)
+				if err != nil {
+					return nil, err
+				}
+				t.params = append(t.params, e)
+			}
+		}
+		templates = append(templates, t)
+		rest = strings.TrimSpace(tail)
+	}
+	return templates, nil
+}
+
+func nextSymbol(s string) (rune, string, error) {
+	for i, r := range s {
+		if r == ' ' || r == '\t' {
+			continue
+		}
+		if r == '(' || r == ')' || r == ',' || r == '=' {
+			return 0, "", fmt.Errorf("unexpected %q", r)
+		}
+		return r, s[i+len(string(r)):], nil
+	}
+	return 0, "", fmt.Errorf("missing symbol")
+}
+
+// Splits "(a, b*(c+1))rest" into its parameters and the rest
+func splitParams(s string) ([]string, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, s, fmt.Errorf("expected '('")
+	}
+
+	var args []string
+	depth, start := 0, 1
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				args = append(args, s[start:i])
+				return args, s[i+1:], nil
+			}
+		case ',':
+			if depth == 1 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("missing ')' in %q", s)
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		letter := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if !letter && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Writes the default parameters of the turn and move commands into the modules,
+// so they draw the same shape without the system (an empty System{}).
+func (s *System) Resolve(modules []Module) []Module {
+	resolved := make([]Module, len(modules))
+	for i, m := range modules {
+		resolved[i] = m
+		if len(m.Params) > 0 {
+			continue
+		}
+		switch m.Symbol {
+		case 'F', 'f':
+			length := s.Length
+			if length == 0 {
+				length = 1
+			}
+			resolved[i].Params = []float64{length}
+		case '+', '-', '&', '^', '\\', '/':
+			resolved[i].Params = []float64{s.Angle}
+		}
+	}
+	return resolved
+}
@@ -0,0 +1,168 @@
+package lsystem
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func mustRule(t *testing.T, s string, weight float64) Rule {
+	t.Helper()
+	rule, err := ParseRule(s, weight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func TestParametricRules(t *testing.T) {
+	axiom, err := Parse("A(4, 1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := &System{
+		Axiom:      axiom,
+		Rules:      []Rule{mustRule(t, "A(l,w)=F(l)!(w)[+(30)A(l*0.5,w-0.25)]", 1)},
+		Iterations: 2,
+	}
+
+	got := Format(system.Expand(rand.New(rand.NewSource(1))))
+	want := "F(4)!(1)[+(30)F(2)!(0.75)[+(30)A(1,0.5)]]"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestStochasticRules(t *testing.T) {
+	system := &System{
+		Axiom: []Module{{Symbol: 'X'}},
+		Rules: []Rule{
+			mustRule(t, "X=a", 3),
+			mustRule(t, "X=b", 1),
+		},
+		Iterations: 1,
+	}
+
+	rng := rand.New(rand.NewSource(7))
+	counts := map[string]int{}
+	for range 4000 {
+		counts[Format(system.Expand(rng))]++
+	}
+	if ratio := float64(counts["a"]) / float64(counts["b"]); ratio < 2.5 || ratio > 3.5 {
+		t.Errorf("rules picked %v, expected about 3 to 1", counts)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	s := "!(0.5)/(137.5)F(2)[&(30)F(1.25)L(2)]f(-1)|"
+	modules, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Format(modules); got != s {
+		t.Errorf("got %s, want %s", got, s)
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	for _, s := range []string{
+		"F",                // no '='
+		"=F",               // no symbol
+		"A(l)=F(x)",        // unknown parameter
+		"A(l)=F(l",         // missing ')'
+		"A(1)=F",           // the left side needs names
+		"AB=F",             // two symbols on the left side
+		"A(l)=F(l*)",       // incomplete expression
+		"A(l)=F((l+1)*2))", // unbalanced
+	} {
+		if _, err := ParseRule(s, 1); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+	if _, err := ParseRule("A=F", 0); err == nil {
+		t.Error("expected an error for a zero weight")
+	}
+}
+
+func TestExpansionLimit(t *testing.T) {
+	system := &System{
+		Axiom:      []Module{{Symbol: 'X'}},
+		Rules:      []Rule{mustRule(t, "X=XXXX", 1)},
+		Iterations: 20,
+	}
+	if n := len(system.Expand(rand.New(rand.NewSource(1)))); n > MaxModules {
+		t.Errorf("%d modules, more than the limit of %d", n, MaxModules)
+	}
+}
+
+type recorder struct {
+	branches [][2]Vec3
+	widths   []float64
+	leaves   []Vec3
+}
+
+func (r *recorder) Branch(from, to Vec3, width float64) {
+	r.branches = append(r.branches, [2]Vec3{from, to})
+	r.widths = append(r.widths, width)
+}
+
+func (r *recorder) Leaves(at Vec3, radius float64) {
+	r.leaves = append(r.leaves, at)
+}
+
+func near(a, b Vec3) bool {
+	return math.Abs(a.X-b.X) < 1e-9 && math.Abs(a.Y-b.Y) < 1e-9 && math.Abs(a.Z-b.Z) < 1e-9
+}
+
+func TestTurtle(t *testing.T) {
+	modules, err := Parse("F(2)[&(90)F(3)L]!(0.25)/(90)&(90)F(1)+(180)F(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recorder{}
+	(&System{}).Draw(modules, NewTurtle(Vec3{}, 1, 0), r)
+
+	if len(r.branches) != 4 || len(r.leaves) != 1 {
+		t.Fatalf("%d branches and %d leaves, expected 4 and 1", len(r.branches), len(r.leaves))
+	}
+	if !near(r.branches[0][1], Vec3{0, 2, 0}) {
+		t.Errorf("trunk ends at %v, expected 0, 2, 0", r.branches[0][1])
+	}
+
+	// Pitching 90 degrees makes the branch horizontal
+	side := r.branches[1][1]
+	if math.Abs(side.Y-2) > 1e-9 || math.Abs(math.Hypot(side.X, side.Z)-3) > 1e-9 {
+		t.Errorf("branch ends at %v, expected 3 blocks away at height 2", side)
+	}
+	if !near(r.leaves[0], side) {
+		t.Errorf("leaves at %v, expected at the end of the branch %v", r.leaves[0], side)
+	}
+
+	// After ']' the turtle is back on the trunk, rolled 90 degrees the pitch goes the other way
+	third := r.branches[2]
+	if !near(third[0], Vec3{0, 2, 0}) || math.Abs(third[1].Y-2) > 1e-9 {
+		t.Errorf("third branch %v, expected horizontal from the top of the trunk", third)
+	}
+	if dot := (Vec3{third[1].X, 0, third[1].Z}).Dot(Vec3{side.X, 0, side.Z}); math.Abs(dot) > 1e-9 {
+		t.Errorf("rolled branch is not perpendicular to the first one")
+	}
+
+	// Turning around goes back to the top of the trunk
+	if !near(r.branches[3][1], Vec3{0, 2, 0}) {
+		t.Errorf("turned branch ends at %v, expected 0, 2, 0", r.branches[3][1])
+	}
+	if r.widths[0] != 1 || r.widths[2] != 0.25 {
+		t.Errorf("widths %v, expected 1 then 0.25", r.widths)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	modules, _ := Parse("F+F(2)&")
+	system := &System{Angle: 25, Length: 1.5}
+
+	got := Format(system.Resolve(modules))
+	if want := "F(1.5)+(25)F(2)&(25)"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
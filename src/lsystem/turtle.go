@@ -0,0 +1,136 @@
+package lsystem
+
+import "math"
+
+type Vec3 struct {
+	X, Y, Z float64
+}
+
+func (a Vec3) Add(b Vec3) Vec3 {
+	return Vec3{a.X + b.X, a.Y + b.Y, a.Z + b.Z}
+}
+
+func (a Vec3) Scale(s float64) Vec3 {
+	return Vec3{a.X * s, a.Y * s, a.Z * s}
+}
+
+func (a Vec3) Cross(b Vec3) Vec3 {
+	return Vec3{a.Y*b.Z - a.Z*b.Y, a.Z*b.X - a.X*b.Z, a.X*b.Y - a.Y*b.X}
+}
+
+func (a Vec3) Dot(b Vec3) float64 {
+	return a.X*b.X + a.Y*b.Y + a.Z*b.Z
+}
+
+// Rotates v around a unit axis (Rodrigues' formula)
+func rotate(v, axis Vec3, degrees float64) Vec3 {
+	rad := degrees * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	return v.Scale(cos).Add(axis.Cross(v).Scale(sin)).Add(axis.Scale(axis.Dot(v) * (1 - cos)))
+}
+
+// Receives what the turtle draws
+type Drawer interface {
+	Branch(from, to Vec3, width float64)
+	Leaves(at Vec3, radius float64)
+}
+
+// Position and orientation of the turtle. Heading is where it moves,
+// Left and Up complete the frame for pitch and roll.
+type Turtle struct {
+	Position Vec3
+	Heading  Vec3
+	Left     Vec3
+	Up       Vec3
+	Width    float64
+}
+
+// Turtle pointing up (+Y), turned around its heading by yaw degrees
+func NewTurtle(position Vec3, width, yaw float64) Turtle {
+	heading := Vec3{0, 1, 0}
+	return Turtle{
+		Position: position,
+		Heading:  heading,
+		Left:     rotate(Vec3{-1, 0, 0}, heading, yaw),
+		Up:       rotate(Vec3{0, 0, 1}, heading, yaw),
+		Width:    width,
+	}
+}
+
+// Branches get this much thinner on '!' without a parameter
+const widthDecay = 0.7
+
+// Draws the modules. Turn commands without a parameter use the angle of the system.
+//
+//	F(l)  draws a branch of length l      f(l)  moves without drawing
+//	+(a)  yaws left                       -(a)  yaws right
+//	&(a)  pitches down                    ^(a)  pitches up
+//	\(a)  rolls left                      /(a)  rolls right
+//	|     turns around                    !(w)  sets the branch width (without w, thinner)
+//	[     saves the turtle                ]     restores it
+//	L(r)  leaves with radius r
+//
+// Other symbols are only used by the rules and draw nothing.
+func (s *System) Draw(modules []Module, turtle Turtle, d Drawer) {
+	var stack []Turtle
+	length := s.Length
+	if length == 0 {
+		length = 1
+	}
+
+	for _, m := range modules {
+		t := &turtle
+		switch m.Symbol {
+		case 'F':
+			next := t.Position.Add(t.Heading.Scale(m.Param(0, length)))
+			d.Branch(t.Position, next, t.Width)
+			t.Position = next
+		case 'f':
+			t.Position = t.Position.Add(t.Heading.Scale(m.Param(0, length)))
+
+		case '+':
+			t.yaw(m.Param(0, s.Angle))
+		case '-':
+			t.yaw(-m.Param(0, s.Angle))
+		case '&':
+			t.pitch(m.Param(0, s.Angle))
+		case '^':
+			t.pitch(-m.Param(0, s.Angle))
+		case '\\':
+			t.roll(m.Param(0, s.Angle))
+		case '/':
+			t.roll(-m.Param(0, s.Angle))
+		case '|':
+			t.yaw(180)
+
+		case '!':
+			t.Width = m.Param(0, t.Width*widthDecay)
+
+		case '[':
+			stack = append(stack, turtle)
+		case ']':
+			if len(stack) > 0 {
+				turtle = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+
+		case 'L':
+			d.Leaves(t.Position, m.Param(0, 2))
+		}
+	}
+}
+
+func (t *Turtle) yaw(degrees float64) {
+	t.Heading = rotate(t.Heading, t.Up, degrees)
+	t.Left = rotate(t.Left, t.Up, degrees)
+}
+
+func (t *Turtle) pitch(degrees float64) {
+	t.Heading = rotate(t.Heading, t.Left, degrees)
+	t.Up = rotate(t.Up, t.Left, degrees)
+}
+
+func (t *Turtle) roll(degrees float64) {
+	t.Left = rotate(t.Left, t.Heading, degrees)
+	t.Up = rotate(t.Up, t.Heading, degrees)
+}
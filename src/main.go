@@ -1,6 +1,10 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"time"
+
 	"go-engine/src/load"
 	"go-engine/src/render"
 	"go-engine/src/world"
@@ -9,7 +13,18 @@ import (
 )
 
 func main() {
-	game := load.InitGame()
+	// The same seed always produces the same world, so bug reports and screenshots can be reproduced
+	seed := flag.Int64("seed", time.Now().UnixNano(), "world seed")
+	height := flag.Int("height", world.DefaultSettings.Height, "world height in blocks above y = 0, multiple of 16 (new worlds only)")
+	depth := flag.Int("depth", world.DefaultSettings.Depth, "world depth in blocks below y = 0, multiple of 16 (new worlds only)")
+	terrain := flag.String("terrain", world.DefaultSettings.Terrain, "terrain mode, heightmap or density (new worlds only)")
+	snowLine := flag.Int("snowline", 0, "height above which the surface is snow, 0 for 55% of the world height (new worlds only)")
+	flag.Parse()
+
+	fmt.Printf("World seed: %d\n", *seed)
+
+	game := load.InitGame(*seed, world.Settings{Height: *height, Depth: *depth, Terrain: *terrain, SnowLine: *snowLine})
+	render.UnloadMeshes(&game.ChunkCache.Events)
 
 	// Main game loop
 	for !rl.WindowShouldClose() {
@@ -32,13 +47,18 @@ func main() {
 		}
 
 		// Manage chunks based on player's position
-		world.ManageChunks(game.Worley, game.BiomeSelector, game.Camera.Position, game.ChunkCache, game.Perlin1, game.Perlin2, game.Perlin3)
+		forward := rl.Vector3Subtract(game.Camera.Target, game.Camera.Position)
+		world.ManageChunks(game.Streamer, game.Camera.Position, forward)
 
 		//  Draw
 		render.RenderGame(&game)
 	}
 	rl.UnloadShader(game.Shader)
 
+	// Keep the chunks that are still loaded for the next session
+	game.Streamer.Close()
+	game.ChunkCache.SaveAll()
+
 	// After the loop ends:
 	defer rl.CloseWindow()
 }
@@ -0,0 +1,127 @@
+package noise
+
+import "math"
+
+// Settings shared by the fractal sources
+type Octaves struct {
+	Count      int     // amount of layers
+	Frequency  float64 // frequency of the first layer
+	Lacunarity float64 // frequency multiplier between layers
+	Gain       float64 // amplitude multiplier between layers (persistence)
+}
+
+// Sensible defaults: each layer has twice the frequency and half the amplitude of the previous one
+func DefaultOctaves(count int, frequency float64) Octaves {
+	return Octaves{Count: count, Frequency: frequency, Lacunarity: 2, Gain: 0.5}
+}
+
+// Each octave samples a shifted area of the base source, so the layers don't line up at the origin
+const octaveOffset = 71.37
+
+// Fractional Brownian motion: the sum of several octaves of the base source
+type FBM struct {
+	Source Source
+	Octaves
+}
+
+func NewFBM(source Source, octaves Octaves) *FBM {
+	return &FBM{Source: source, Octaves: octaves}
+}
+
+func (f *FBM) Noise2D(x, z float64) float64 {
+	sum, amplitude, frequency, total := 0.0, 1.0, f.Frequency, 0.0
+	for i := 0; i < f.Count; i++ {
+		offset := float64(i) * octaveOffset
+		sum += f.Source.Noise2D(x*frequency+offset, z*frequency+offset) * amplitude
+		total += amplitude
+		amplitude *= f.Gain
+		frequency *= f.Lacunarity
+	}
+	return sum / total
+}
+
+func (f *FBM) Noise3D(x, y, z float64) float64 {
+	sum, amplitude, frequency, total := 0.0, 1.0, f.Frequency, 0.0
+	for i := 0; i < f.Count; i++ {
+		offset := float64(i) * octaveOffset
+		sum += f.Source.Noise3D(x*frequency+offset, y*frequency+offset, z*frequency+offset) * amplitude
+		total += amplitude
+		amplitude *= f.Gain
+		frequency *= f.Lacunarity
+	}
+	return sum / total
+}
+
+// Billow noise: octaves of |n|, round puffy shapes (clouds, dunes, hills)
+type Billow struct {
+	Source Source
+	Octaves
+}
+
+func NewBillow(source Source, octaves Octaves) *Billow {
+	return &Billow{Source: source, Octaves: octaves}
+}
+
+func (b *Billow) Noise2D(x, z float64) float64 {
+	sum, amplitude, frequency, total := 0.0, 1.0, b.Frequency, 0.0
+	for i := 0; i < b.Count; i++ {
+		offset := float64(i) * octaveOffset
+		sum += (2*math.Abs(b.Source.Noise2D(x*frequency+offset, z*frequency+offset)) - 1) * amplitude
+		total += amplitude
+		amplitude *= b.Gain
+		frequency *= b.Lacunarity
+	}
+	return sum / total
+}
+
+func (b *Billow) Noise3D(x, y, z float64) float64 {
+	sum, amplitude, frequency, total := 0.0, 1.0, b.Frequency, 0.0
+	for i := 0; i < b.Count; i++ {
+		offset := float64(i) * octaveOffset
+		sum += (2*math.Abs(b.Source.Noise3D(x*frequency+offset, y*frequency+offset, z*frequency+offset)) - 1) * amplitude
+		total += amplitude
+		amplitude *= b.Gain
+		frequency *= b.Lacunarity
+	}
+	return sum / total
+}
+
+// Ridged multifractal (Musgrave): sharp crests where the base source crosses 0 (mountain ranges, rivers, tunnels).
+// Each octave is weighted by the previous one, so detail piles up on the ridges and the valleys stay smooth.
+type Ridged struct {
+	Source Source
+	Octaves
+}
+
+func NewRidged(source Source, octaves Octaves) *Ridged {
+	return &Ridged{Source: source, Octaves: octaves}
+}
+
+func (r *Ridged) Noise2D(x, z float64) float64 {
+	return r.sum(func(frequency, offset float64) float64 {
+		return r.Source.Noise2D(x*frequency+offset, z*frequency+offset)
+	})
+}
+
+func (r *Ridged) Noise3D(x, y, z float64) float64 {
+	return r.sum(func(frequency, offset float64) float64 {
+		return r.Source.Noise3D(x*frequency+offset, y*frequency+offset, z*frequency+offset)
+	})
+}
+
+func (r *Ridged) sum(sample func(frequency, offset float64) float64) float64 {
+	sum, amplitude, frequency, total, weight := 0.0, 1.0, r.Frequency, 0.0, 1.0
+	for i := 0; i < r.Count; i++ {
+		signal := 1 - math.Abs(sample(frequency, float64(i)*octaveOffset))
+		signal *= signal * weight
+
+		// The weight stays in [0, 1], so the result does too (before being mapped to [-1, 1])
+		weight = math.Max(0, math.Min(1, signal*2))
+
+		sum += signal * amplitude
+		total += amplitude
+		amplitude *= r.Gain
+		frequency *= r.Lacunarity
+	}
+	return sum/total*2 - 1
+}
@@ -0,0 +1,24 @@
+// Composable noise sources shared by the terrain, caves, clouds and vegetation.
+//
+// Every source returns values in [-1, 1] (unless stated otherwise), so they can be
+// stacked freely: a fractal can wrap a warp that wraps another fractal, and so on.
+package noise
+
+// Common interface of every noise source, in 2D (x, z on the ground) and 3D
+type Source interface {
+	Noise2D(x, z float64) float64
+	Noise3D(x, y, z float64) float64
+}
+
+// Mixes a seed with a salt (SplitMix64), so every source of a world gets its own independent stream
+func DeriveSeed(seed, salt int64) int64 {
+	z := uint64(seed) + uint64(salt)*0x9E3779B97F4A7C15
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return int64(z ^ (z >> 31))
+}
+
+// Maps a value in [-1, 1] to [0, 1]
+func Normalize(n float64) float64 {
+	return (n + 1) / 2
+}
@@ -0,0 +1,137 @@
+package noise
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func sources(seed int64) map[string]Source {
+	octaves := DefaultOctaves(5, 0.01)
+	return map[string]Source{
+		"Perlin": NewPerlin(seed),
+		"FBM":    NewFBM(NewPerlin(seed), octaves),
+		"Billow": NewBillow(NewPerlin(seed), octaves),
+		"Ridged": NewRidged(NewPerlin(seed), octaves),
+		"Warp":   NewWarp(NewFBM(NewPerlin(seed), octaves), seed, DefaultOctaves(2, 0.005), 40),
+	}
+}
+
+func TestSourcesStayInRange(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for name, source := range sources(42) {
+		lo2, hi2, lo3, hi3 := 1.0, -1.0, 1.0, -1.0
+
+		for i := 0; i < 20000; i++ {
+			x := (r.Float64() - 0.5) * 20000
+			y := (r.Float64() - 0.5) * 20000
+			z := (r.Float64() - 0.5) * 20000
+
+			n2 := source.Noise2D(x, z)
+			n3 := source.Noise3D(x, y, z)
+
+			if n2 < -1 || n2 > 1 {
+				t.Fatalf("%s: Noise2D(%f, %f) = %f is outside [-1, 1]", name, x, z, n2)
+			}
+			if n3 < -1 || n3 > 1 {
+				t.Fatalf("%s: Noise3D(%f, %f, %f) = %f is outside [-1, 1]", name, x, y, z, n3)
+			}
+
+			lo2, hi2 = min(lo2, n2), max(hi2, n2)
+			lo3, hi3 = min(lo3, n3), max(hi3, n3)
+		}
+
+		// A source stuck on a narrow band is as broken as one that leaves the range
+		if hi2-lo2 < 0.5 || hi3-lo3 < 0.5 {
+			t.Errorf("%s: values only cover [%f, %f] in 2D and [%f, %f] in 3D", name, lo2, hi2, lo3, hi3)
+		}
+	}
+}
+
+func TestPerlinIsZeroOnTheLattice(t *testing.T) {
+	p := NewPerlin(7)
+
+	for x := -5; x <= 5; x++ {
+		for z := -5; z <= 5; z++ {
+			if n := p.Noise2D(float64(x), float64(z)); n != 0 {
+				t.Fatalf("Noise2D(%d, %d) = %f, want 0", x, z, n)
+			}
+			if n := p.Noise3D(float64(x), 3, float64(z)); n != 0 {
+				t.Fatalf("Noise3D(%d, 3, %d) = %f, want 0", x, z, n)
+			}
+		}
+	}
+}
+
+func TestSourcesAreDeterministic(t *testing.T) {
+	a, b, c := sources(99), sources(99), sources(100)
+
+	for name := range a {
+		same, different := true, false
+
+		for i := 0; i < 100; i++ {
+			x, y, z := float64(i)*13.37, float64(i)*2.5, float64(i)*-7.1
+
+			if a[name].Noise3D(x, y, z) != b[name].Noise3D(x, y, z) {
+				same = false
+			}
+			if a[name].Noise2D(x, z) != c[name].Noise2D(x, z) {
+				different = true
+			}
+		}
+
+		if !same {
+			t.Errorf("%s: the same seed produced different values", name)
+		}
+		if !different {
+			t.Errorf("%s: different seeds produced the same values", name)
+		}
+	}
+}
+
+func TestDeriveSeed(t *testing.T) {
+	seen := make(map[int64]bool)
+
+	for seed := int64(0); seed < 100; seed++ {
+		for salt := int64(0); salt < 100; salt++ {
+			derived := DeriveSeed(seed, salt)
+			if seen[derived] {
+				t.Fatalf("DeriveSeed(%d, %d) collides with a previous seed", seed, salt)
+			}
+			seen[derived] = true
+		}
+	}
+
+	if DeriveSeed(5, 1) != DeriveSeed(5, 1) {
+		t.Error("DeriveSeed is not deterministic")
+	}
+}
+
+func BenchmarkPerlin2D(b *testing.B) {
+	p := NewPerlin(1)
+	for i := 0; b.Loop(); i++ {
+		p.Noise2D(float64(i)*0.37, float64(i)*0.11)
+	}
+}
+
+func BenchmarkPerlin3D(b *testing.B) {
+	p := NewPerlin(1)
+	for i := 0; b.Loop(); i++ {
+		p.Noise3D(float64(i)*0.37, float64(i)*0.23, float64(i)*0.11)
+	}
+}
+
+func BenchmarkSources(b *testing.B) {
+	for name, source := range sources(1) {
+		b.Run(name+"2D", func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				source.Noise2D(float64(i)*0.37, float64(i)*0.11)
+			}
+		})
+		b.Run(name+"3D", func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				source.Noise3D(float64(i)*0.37, float64(i)*0.23, float64(i)*0.11)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package noise
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Improved gradient noise (Ken Perlin, 2002).
+// Both variants return values in [-1, 1] and are 0 on every lattice point.
+type Perlin struct {
+	perm [512]uint8
+}
+
+func NewPerlin(seed int64) *Perlin {
+	p := &Perlin{}
+
+	r := rand.New(rand.NewSource(seed))
+	for i, v := range r.Perm(256) {
+		p.perm[i] = uint8(v)
+		p.perm[i+256] = uint8(v)
+	}
+	return p
+}
+
+func (p *Perlin) Noise2D(x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	xi, yi := int(x0)&255, int(y0)&255
+	xf, yf := x-x0, y-y0
+
+	u, v := fade(xf), fade(yf)
+
+	aa := p.perm[int(p.perm[xi])+yi]
+	ab := p.perm[int(p.perm[xi])+yi+1]
+	ba := p.perm[int(p.perm[xi+1])+yi]
+	bb := p.perm[int(p.perm[xi+1])+yi+1]
+
+	n := lerp(v,
+		lerp(u, grad2(aa, xf, yf), grad2(ba, xf-1, yf)),
+		lerp(u, grad2(ab, xf, yf-1), grad2(bb, xf-1, yf-1)),
+	)
+	return clamp(n)
+}
+
+func (p *Perlin) Noise3D(x, y, z float64) float64 {
+	x0, y0, z0 := math.Floor(x), math.Floor(y), math.Floor(z)
+	xi, yi, zi := int(x0)&255, int(y0)&255, int(z0)&255
+	xf, yf, zf := x-x0, y-y0, z-z0
+
+	u, v, w := fade(xf), fade(yf), fade(zf)
+
+	a := int(p.perm[xi]) + yi
+	aa := int(p.perm[a]) + zi
+	ab := int(p.perm[a+1]) + zi
+	b := int(p.perm[xi+1]) + yi
+	ba := int(p.perm[b]) + zi
+	bb := int(p.perm[b+1]) + zi
+
+	n := lerp(w,
+		lerp(v,
+			lerp(u, grad3(p.perm[aa], xf, yf, zf), grad3(p.perm[ba], xf-1, yf, zf)),
+			lerp(u, grad3(p.perm[ab], xf, yf-1, zf), grad3(p.perm[bb], xf-1, yf-1, zf)),
+		),
+		lerp(v,
+			lerp(u, grad3(p.perm[aa+1], xf, yf, zf-1), grad3(p.perm[ba+1], xf-1, yf, zf-1)),
+			lerp(u, grad3(p.perm[ab+1], xf, yf-1, zf-1), grad3(p.perm[bb+1], xf-1, yf-1, zf-1)),
+		),
+	)
+	return clamp(n)
+}
+
+// 6t^5 - 15t^4 + 10t^3, smooth at the lattice borders
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// The peaks of the noise touch ±1, this only guards against rounding errors
+func clamp(n float64) float64 {
+	return math.Max(-1, math.Min(1, n))
+}
+
+// Dot product with one of 8 gradients (axes and diagonals)
+func grad2(hash uint8, x, y float64) float64 {
+	switch hash & 7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x
+	case 5:
+		return -x
+	case 6:
+		return y
+	default:
+		return -y
+	}
+}
+
+// Dot product with one of the 12 edge gradients of a cube
+func grad3(hash uint8, x, y, z float64) float64 {
+	h := hash & 15
+
+	u := y
+	if h < 8 {
+		u = x
+	}
+
+	var v float64
+	switch {
+	case h < 4:
+		v = y
+	case h == 12 || h == 14:
+		v = x
+	default:
+		v = z
+	}
+
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
@@ -0,0 +1,31 @@
+package noise
+
+// Domain warping: the coordinates are pushed around by other sources before sampling,
+// turning regular blobs into swirly, natural looking shapes.
+type Warp struct {
+	Source   Source
+	Offset   [3]Source // displacement along x, y and z (y is only used in 3D)
+	Strength float64   // maximum displacement, in the units of the coordinates
+}
+
+// Builds the three displacement sources from a seed, with the given octaves
+func NewWarp(source Source, seed int64, octaves Octaves, strength float64) *Warp {
+	var offset [3]Source
+	for i := range offset {
+		offset[i] = NewFBM(NewPerlin(DeriveSeed(seed, int64(i))), octaves)
+	}
+	return &Warp{Source: source, Offset: offset, Strength: strength}
+}
+
+func (w *Warp) Noise2D(x, z float64) float64 {
+	dx := w.Offset[0].Noise2D(x, z) * w.Strength
+	dz := w.Offset[2].Noise2D(x, z) * w.Strength
+	return w.Source.Noise2D(x+dx, z+dz)
+}
+
+func (w *Warp) Noise3D(x, y, z float64) float64 {
+	dx := w.Offset[0].Noise3D(x, y, z) * w.Strength
+	dy := w.Offset[1].Noise3D(x, y, z) * w.Strength
+	dz := w.Offset[2].Noise3D(x, y, z) * w.Strength
+	return w.Source.Noise3D(x+dx, y+dy, z+dz)
+}
@@ -0,0 +1,103 @@
+package pkg
+
+// Generation stage reached by a column. Each stage only starts once the neighbors
+// (the 8 columns around) reached the stage before, see world.ManageChunks.
+// Every stage runs once: saved columns keep their stage, and later changes (edits, new
+// neighbors) only remesh the chunks (Chunk.NeedsRemesh).
+type Stage int
+
+const (
+	StageTerrain   Stage = iota + 1 // terrain, carvers (caves, rivers), water, ores and structures, all inside the column
+	StageDecorated                  // plants and trees, which also write into the neighbors
+	StageFinal                      // generation won't write into the column anymore, its chunks can be meshed
+)
+
+// A vertical stack of chunks with the same X and Z, and the data shared by the whole column.
+// Terrain is generated and saved per column, while meshing and culling work on its chunks.
+type Column struct {
+	X, Z       int
+	MinSection int                       // chunk Y of Sections[0]
+	Sections   []*Chunk                  // bottom to top, nil where the chunk is empty (only air)
+	HeightMap  [ChunkSize][ChunkSize]int // final height per terrain column
+	BiomeMap   [ChunkSize][ChunkSize]BiomeProperties
+	Plants     []PlantData
+	Trees      []TreeData
+	TreesFrom  uint16 // neighbors whose trees were written into the column, one bit each
+	Stage      Stage
+	IsDirty    bool // the player changed the column since it was last saved to disk
+}
+
+// sections is the amount of chunks stacked from minSection up
+func NewColumn(x, z, minSection, sections int) *Column {
+	return &Column{
+		X:          x,
+		Z:          z,
+		MinSection: minSection,
+		Sections:   make([]*Chunk, sections),
+	}
+}
+
+// Lowest world Y of the column
+func (c *Column) MinY() int {
+	return c.MinSection * ChunkSize
+}
+
+// World Y right above the top of the column
+func (c *Column) MaxY() int {
+	return (c.MinSection + len(c.Sections)) * ChunkSize
+}
+
+// Returns the chunk at a chunk Y, nil when it is empty or outside the column
+func (c *Column) Section(chunkY int) *Chunk {
+	i := chunkY - c.MinSection
+	if i < 0 || i >= len(c.Sections) {
+		return nil
+	}
+	return c.Sections[i]
+}
+
+// x and z are local to the column, y is the world height. Outside the column it is air.
+func (c *Column) Get(x, y, z int) VoxelData {
+	chunk := c.Section(floorDiv(y, ChunkSize))
+	if chunk == nil {
+		return VoxelData{}
+	}
+	return chunk.Voxels.Get(x, y-chunk.Coord.Y*ChunkSize, z)
+}
+
+// Sets a voxel, creating its chunk when needed. Returns false (and does nothing) when y is outside the column.
+func (c *Column) Set(x, y, z int, voxel VoxelData) bool {
+	chunkY := floorDiv(y, ChunkSize)
+	i := chunkY - c.MinSection
+	if i < 0 || i >= len(c.Sections) {
+		return false
+	}
+
+	chunk := c.Sections[i]
+	if chunk == nil {
+		if voxel == (VoxelData{}) {
+			return true // air in an empty chunk, nothing to do
+		}
+		chunk = &Chunk{Coord: Coords{X: c.X, Y: chunkY, Z: c.Z}, Column: c}
+		c.Sections[i] = chunk
+	}
+	chunk.Voxels.Set(x, y-chunkY*ChunkSize, z, voxel)
+	return true
+}
+
+// Drops the chunks that only have air left (after caves, for example)
+func (c *Column) Compact() {
+	for i, chunk := range c.Sections {
+		if chunk != nil && chunk.Voxels.IsEmpty() {
+			c.Sections[i] = nil
+		}
+	}
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
@@ -1,7 +1,8 @@
 package pkg
 
 import (
-	"github.com/aquilax/go-perlin"
+	"go-engine/src/lsystem"
+
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
@@ -10,16 +11,19 @@ var PlantModels [4]rl.Model
 var ChunkDistance int = 5
 
 const (
-	WorldHeight        int     = 112
-	CloudHeight        int     = 92
 	ChunkSize          int     = 16
-	WaterLevelFraction float64 = 0.375 // 3/8
+	WaterLevelFraction float64 = 0.375 // 3/8 of the world height
+	SnowLineFraction   float64 = 0.55  // default height of the snow caps, as a fraction of the world height
 )
 
+// Numeric ID of a block type (see world.Blocks). 0 is always air.
+type BlockID uint16
+
+// A single voxel. It is comparable, so identical voxels share the same palette entry of the chunk.
 type VoxelData struct {
-	Type  string
-	Model rl.Model
-	Color rl.Color
+	Type    BlockID
+	Color   rl.Color
+	ModelID int // index in PlantModels (plants only)
 }
 
 // Stores plant positions
@@ -31,29 +35,29 @@ type PlantData struct {
 type TreeData struct {
 	Position     rl.Vector3
 	StructureStr string
+	Species      string
 }
 
 type SpecialVoxel struct {
 	Position  Coords
-	Type      string
+	Type      BlockID
 	Model     rl.Model // for plants
 	IsSurface bool     // for water
 }
 
 type TransparentItem struct {
 	Position       rl.Vector3
-	Type           string
+	Type           BlockID
 	Color          rl.Color
 	IsSurfaceWater bool
 }
 
+// A 16³ sub-chunk. Chunks are stacked in columns (see Column), Coord.Y is the position in the stack.
 type Chunk struct {
-	Voxels    [ChunkSize][WorldHeight][ChunkSize]VoxelData
-	HeightMap [ChunkSize][ChunkSize]int // final height per terrain column
-	BiomeMap  [ChunkSize][ChunkSize]BiomeProperties
-	Neighbors [4]*Chunk // 0: +X, 1: -X, 2: 4: +Z, 5: -Z
-	Plants    []PlantData
-	Trees     []TreeData
+	Coord     Coords
+	Column    *Column // column the chunk belongs to
+	Voxels    VoxelStorage
+	Neighbors [6]*Chunk // same order as FaceDirections, nil when the neighbor is empty or not loaded
 
 	// Buffers reutilizáveis para mesh
 	Vertices []float32
@@ -61,27 +65,88 @@ type Chunk struct {
 	Colors   []uint8
 	Normals  []float32
 
-	Mesh          rl.Mesh
-	Model         rl.Model
-	SpecialVoxels []SpecialVoxel
-	IsOutdated    bool // Flag to know if you need to update the mesh
+	// Solid blocks that can be seen through (ice) have a mesh of their own, drawn after the others
+	Translucent MeshBuffers
+
+	Mesh             rl.Mesh
+	Model            rl.Model
+	TranslucentModel rl.Model
+	SpecialVoxels    []SpecialVoxel
+	State            ChunkState // changed through world.ChunkCache.Transition, which tells the subscribers
+
+	// The voxels or the neighbors changed: the mesh is rebuilt from the voxels it already has.
+	// Nothing is generated again, a column goes through the generation once (see Column.Stage).
+	NeedsRemesh bool
+}
+
+// Vertex data of a mesh, kept by the chunk so the slices are reused when it is rebuilt
+type MeshBuffers struct {
+	Vertices []float32
+	Indices  []uint16
+	Colors   []uint8
+	Normals  []float32
 }
 
 type Coords struct {
 	X, Y, Z int
 }
 
-// Function that calculates the height of a biome
-type HeightFunc func(gx, gz int, p2, p3 *perlin.Perlin) float64
+// One layer of a biome's height modifier, the layers of a biome are added together
+type NoiseLayer struct {
+	Source    string  `json:"source"` // noise source of the generator: "primary" or "secondary"
+	Frequency float64 `json:"frequency"`
+	Amplitude float64 `json:"amplitude"`
+	Power     float64 `json:"power"`     // sharpens (> 1) or flattens (< 1) the shape, 0 keeps it as is
+	Abs       bool    `json:"abs"`       // uses |n|, folding valleys into peaks
+	Ridged    bool    `json:"ridged"`    // uses 1 - |n|, creating sharp ridges
+	Normalize bool    `json:"normalize"` // maps [-1, 1] to [0, 1]
+}
+
+// Climate where a biome can appear, each field is a [min, max] range inside [0, 1]
+type ClimateRange struct {
+	Temperature     [2]float64 `json:"temperature"`
+	Humidity        [2]float64 `json:"humidity"`
+	Continentalness [2]float64 `json:"continentalness"` // 0: deep ocean, 1: far inland
+	Altitude        [2]float64 `json:"altitude"`
+}
+
+// How many caves of each kind a biome has, 1 is the default amount and 0 disables them
+type CaveSettings struct {
+	Cheese    float64 `json:"cheese"`    // large open caverns
+	Spaghetti float64 `json:"spaghetti"` // long winding tunnels
+	Noodle    float64 `json:"noodle"`    // thin twisty tunnels
+}
+
+// A kind of tree, loaded from assets/data/trees.json
+type TreeSpecies struct {
+	Name        string
+	Trunk       BlockID
+	Leaves      BlockID
+	LeavesColor rl.Color   // the zero color uses the leaves color of the biome
+	Canopy      string     // shape of the leaves: "sphere", "cone", "umbrella" or "blob"
+	Height      [2]float64 // range of h, the trunk height used by the axiom
+	CanopySize  [2]float64 // range of the radius of the leaves without a parameter
+	Axiom       *lsystem.Pattern
+	Growth      lsystem.System // rules, iterations, angle and width, the axiom comes from Axiom
+}
 
 type BiomeProperties struct {
-	Modifier         HeightFunc
-	SurfaceBlock     string
-	UndergroundBlock string
-	TreeTypes        []string
-	TreeDensity      float32
-	GrassColor       rl.Color
-	LeavesColor      rl.Color
+	Name              string
+	Climate           ClimateRange
+	HeightScale       float64      // height modifier scale, as a fraction of the world height
+	HeightLayers      []NoiseLayer // height modifier
+	SurfaceBlock      string
+	UndergroundBlock  string
+	FillerDepth       int            // amount of underground blocks between the surface and the stone
+	TreeTypes         []*TreeSpecies // a species can repeat to be more common
+	TreeDensity       float32
+	VegetationDensity float32 // chance of each plant attempt succeeding
+	Caves             CaveSettings
+	Frozen            bool     // the surface of its water turns to ice
+	Sea               string   // kind of sea biome (world.SeaOcean...), empty for land biomes
+	FloorBlocks       []string // blocks of the sea floor, in patches
+	GrassColor        rl.Color
+	LeavesColor       rl.Color
 }
 
 var FaceDirections = []rl.Vector3{
@@ -93,13 +158,6 @@ var FaceDirections = []rl.Vector3{
 	{0, 0, -1}, // Bottom
 }
 
-var HorizontalDirections = []rl.Vector3{
-	{1, 0, 0},
-	{-1, 0, 0},
-	{0, 0, 1},
-	{0, 0, -1},
-}
-
 var FaceVertices = [6][4][3]float32{
 	// Face 0: Right (+X)
 	{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}},
@@ -0,0 +1,48 @@
+package pkg
+
+// Where a chunk is in its life, from the request of its column until it is saved or dropped after unloading.
+// The zero value is a chunk that was just created.
+type ChunkState uint8
+
+const (
+	ChunkRequested  ChunkState = iota + 1 // its column is waiting for a worker
+	ChunkGenerating                       // a worker is loading or generating its column
+	ChunkGenerated                        // terrain stage
+	ChunkDecorated                        // plants and trees, waiting for its first mesh
+	ChunkMeshed                           // has a mesh, but it isn't drawn
+	ChunkVisible                          // drawn
+	ChunkUnloading                        // removed from the world, waiting to be saved
+	ChunkSaved                            // its column was written to disk, the chunk is gone
+	ChunkDiscarded                        // gone without being written: the seed generates it again
+)
+
+var chunkStateNames = [...]string{"new", "requested", "generating", "generated", "decorated", "meshed", "visible", "unloading", "saved", "discarded"}
+
+func (s ChunkState) String() string {
+	if int(s) < len(chunkStateNames) {
+		return chunkStateNames[s]
+	}
+	return "unknown"
+}
+
+// States a chunk can move to from each state
+var chunkTransitions = map[ChunkState][]ChunkState{
+	0:               {ChunkRequested, ChunkGenerated, ChunkDecorated}, // chunks created by a write after their column was generated
+	ChunkRequested:  {ChunkGenerating, ChunkUnloading},                // column requests that are cancelled end unloading
+	ChunkGenerating: {ChunkGenerated, ChunkDecorated, ChunkUnloading}, // columns read from disk can be past the terrain stage
+	ChunkGenerated:  {ChunkDecorated, ChunkUnloading},
+	ChunkDecorated:  {ChunkMeshed, ChunkUnloading},
+	ChunkMeshed:     {ChunkVisible, ChunkUnloading},
+	ChunkVisible:    {ChunkMeshed, ChunkUnloading},
+	ChunkUnloading:  {ChunkSaved, ChunkDiscarded},
+}
+
+// Tells if a chunk can go from one state to the other
+func (s ChunkState) CanBecome(to ChunkState) bool {
+	for _, next := range chunkTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import "math/bits"
+
+// Number of voxels in a chunk
+const ChunkVolume = ChunkSize * ChunkSize * ChunkSize
+
+// Compact voxel storage.
+// Each voxel only keeps an index into a per-chunk palette of distinct voxels, packed with as
+// few bits as the palette needs (a chunk with 9 different voxels uses 4 bits per voxel).
+// The zero value is an empty chunk where every voxel is VoxelData{}.
+type VoxelStorage struct {
+	palette []VoxelData
+	lookup  map[VoxelData]uint16 // palette entry → index
+	bits    int                  // bits per voxel
+	data    []uint64
+}
+
+// Linear position of a voxel (x → y → z, the same order used by the mesher)
+func voxelIndex(x, y, z int) int {
+	return (x*ChunkSize+y)*ChunkSize + z
+}
+
+func (vs *VoxelStorage) Get(x, y, z int) VoxelData {
+	if vs.bits == 0 {
+		return VoxelData{}
+	}
+	return vs.palette[vs.read(voxelIndex(x, y, z))]
+}
+
+// Returns the palette index of a voxel, meant to be used together with Palette()
+func (vs *VoxelStorage) Index(x, y, z int) uint16 {
+	if vs.bits == 0 {
+		return 0
+	}
+	return vs.read(voxelIndex(x, y, z))
+}
+
+// Distinct voxels of the chunk. Index 0 is always the empty voxel.
+// The returned slice must not be modified.
+func (vs *VoxelStorage) Palette() []VoxelData {
+	if len(vs.palette) == 0 {
+		return []VoxelData{{}}
+	}
+	return vs.palette
+}
+
+func (vs *VoxelStorage) Set(x, y, z int, voxel VoxelData) {
+	if vs.bits == 0 {
+		if voxel == (VoxelData{}) {
+			return // already empty, nothing to allocate
+		}
+		vs.palette = []VoxelData{{}}
+		vs.lookup = map[VoxelData]uint16{{}: 0}
+		vs.resize(1)
+	}
+
+	index, ok := vs.lookup[voxel]
+	if !ok {
+		// Every voxel is repacked anyway when the palette outgrows the bit width, so the
+		// entries that are not used anymore are dropped first
+		if bits.Len(uint(len(vs.palette))) > vs.bits {
+			vs.shrink()
+		}
+
+		index = uint16(len(vs.palette))
+		vs.palette = append(vs.palette, voxel)
+		vs.lookup[voxel] = index
+
+		// The palette outgrew the current bit width → repack every voxel
+		if needed := bits.Len(uint(index)); needed > vs.bits {
+			vs.resize(needed)
+		}
+	}
+
+	vs.write(voxelIndex(x, y, z), index)
+}
+
+// Removes the palette entries that no voxel uses (but the empty one, always at index 0).
+// Indices change, so voxels are rewritten with as few bits as the smaller palette needs.
+func (vs *VoxelStorage) shrink() {
+	used := make([]bool, len(vs.palette))
+	used[0] = true
+	for i := 0; i < ChunkVolume; i++ {
+		used[vs.read(i)] = true
+	}
+
+	remap := make([]uint16, len(vs.palette))
+	var palette []VoxelData
+	lookup := make(map[VoxelData]uint16)
+	for old, voxel := range vs.palette {
+		if used[old] {
+			remap[old] = uint16(len(palette))
+			lookup[voxel] = uint16(len(palette))
+			palette = append(palette, voxel)
+		}
+	}
+	if len(palette) == len(vs.palette) {
+		return
+	}
+
+	old := *vs
+	vs.palette = palette
+	vs.lookup = lookup
+	vs.bits = max(1, bits.Len(uint(len(palette)-1)))
+	vs.data = make([]uint64, (ChunkVolume+64/vs.bits-1)/(64/vs.bits))
+	for i := 0; i < ChunkVolume; i++ {
+		vs.write(i, remap[old.read(i)])
+	}
+}
+
+// Tells if every voxel is air (sub-chunks like that are not stored or meshed)
+func (vs *VoxelStorage) IsEmpty() bool {
+	if vs.bits == 0 {
+		return true
+	}
+	for i := 0; i < ChunkVolume; i++ {
+		if vs.palette[vs.read(i)].Type != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (vs *VoxelStorage) read(i int) uint16 {
+	perWord := 64 / vs.bits
+	word := vs.data[i/perWord]
+	shift := uint(i%perWord) * uint(vs.bits)
+	return uint16((word >> shift) & (1<<uint(vs.bits) - 1))
+}
+
+func (vs *VoxelStorage) write(i int, index uint16) {
+	perWord := 64 / vs.bits
+	shift := uint(i%perWord) * uint(vs.bits)
+	mask := uint64(1<<uint(vs.bits)-1) << shift
+	vs.data[i/perWord] = vs.data[i/perWord]&^mask | uint64(index)<<shift
+}
+
+func (vs *VoxelStorage) resize(newBits int) {
+	old := *vs
+
+	perWord := 64 / newBits
+	vs.bits = newBits
+	vs.data = make([]uint64, (ChunkVolume+perWord-1)/perWord)
+
+	if old.bits == 0 {
+		return
+	}
+	for i := 0; i < ChunkVolume; i++ {
+		vs.write(i, old.read(i))
+	}
+}
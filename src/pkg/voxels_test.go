@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"math/bits"
+	"testing"
+)
+
+// A voxel of each type, so palettes of any size can be built
+func typed(i int) VoxelData {
+	return VoxelData{Type: BlockID(i)}
+}
+
+// Every voxel gets one of n types, in a pattern that puts neighbors in different entries
+func fill(vs *VoxelStorage, n int) {
+	for x := range ChunkSize {
+		for y := range ChunkSize {
+			for z := range ChunkSize {
+				vs.Set(x, y, z, typed(1+voxelIndex(x, y, z)%n))
+			}
+		}
+	}
+}
+
+func check(t *testing.T, vs *VoxelStorage, n int) {
+	t.Helper()
+	for x := range ChunkSize {
+		for y := range ChunkSize {
+			for z := range ChunkSize {
+				if got, want := vs.Get(x, y, z), typed(1+voxelIndex(x, y, z)%n); got != want {
+					t.Fatalf("voxel %d %d %d is %v, want %v", x, y, z, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestVoxelStorageBitWidths(t *testing.T) {
+	// Palettes on both sides of each power of two. Widths like 3, 5, 6 and 7 don't divide 64,
+	// so the last bits of each word are left unused.
+	for _, n := range []int{1, 2, 3, 4, 7, 8, 15, 16, 31, 32, 63, 64, 127, 128, 255, 256, 1000} {
+		var vs VoxelStorage
+		fill(&vs, n)
+		check(t, &vs, n)
+
+		// The palette also has the empty voxel
+		if want := max(1, bits.Len(uint(n))); vs.bits != want {
+			t.Errorf("%d types use %d bits per voxel, want %d", n, vs.bits, want)
+		}
+		if len(vs.Palette()) != n+1 {
+			t.Errorf("%d types have a palette of %d", n, len(vs.Palette()))
+		}
+	}
+}
+
+func TestVoxelStorageRepacks(t *testing.T) {
+	var vs VoxelStorage
+	fill(&vs, 3)
+
+	// The fourth type needs 3 bits, every voxel is moved to the wider words
+	vs.Set(15, 15, 15, typed(50))
+	if vs.bits != 3 {
+		t.Fatalf("%d bits per voxel after the palette grew past 4", vs.bits)
+	}
+	if vs.Get(15, 15, 15) != typed(50) {
+		t.Error("the voxel that grew the palette was lost")
+	}
+	vs.Set(15, 15, 15, typed(1+voxelIndex(15, 15, 15)%3))
+	check(t, &vs, 3)
+}
+
+func TestVoxelStorageIsEmpty(t *testing.T) {
+	var vs VoxelStorage
+	if !vs.IsEmpty() || vs.Get(3, 4, 5) != (VoxelData{}) {
+		t.Fatal("the zero value isn't empty")
+	}
+
+	vs.Set(3, 4, 5, VoxelData{})
+	if vs.data != nil {
+		t.Error("writing air to an empty chunk allocated it")
+	}
+
+	vs.Set(3, 4, 5, typed(2))
+	vs.Set(0, 0, 0, typed(3))
+	if vs.IsEmpty() {
+		t.Error("a chunk with two blocks is empty")
+	}
+
+	// The palette still has the blocks, but no voxel uses them
+	vs.Set(3, 4, 5, VoxelData{})
+	vs.Set(0, 0, 0, VoxelData{})
+	if !vs.IsEmpty() {
+		t.Error("a chunk that was set back to air isn't empty")
+	}
+}
+
+func TestVoxelStorageShrinks(t *testing.T) {
+	var vs VoxelStorage
+	fill(&vs, 100)
+	if vs.bits != 7 {
+		t.Fatalf("%d bits per voxel for 101 entries", vs.bits)
+	}
+
+	// Only 2 types are left, then new ones are added until the palette has to grow
+	fill(&vs, 2)
+	for i := len(vs.Palette()); i <= 1<<7; i++ {
+		vs.Set(0, 0, 0, typed(1000+i))
+	}
+	vs.Set(0, 0, 0, typed(1))
+
+	// Air, the 2 types and the last 2 that were added
+	if len(vs.Palette()) != 5 || vs.bits != 3 {
+		t.Errorf("the palette kept unused entries: %d entries, %d bits per voxel", len(vs.Palette()), vs.bits)
+	}
+	if vs.Palette()[0] != (VoxelData{}) {
+		t.Error("the empty voxel isn't the first entry anymore")
+	}
+	check(t, &vs, 2)
+
+	// Palette and indices still agree
+	palette := vs.Palette()
+	for x := range ChunkSize {
+		if palette[vs.Index(x, 1, 2)] != vs.Get(x, 1, 2) {
+			t.Fatalf("palette index of voxel %d 1 2 doesn't match the voxel", x)
+		}
+	}
+}
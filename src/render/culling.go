@@ -15,11 +15,13 @@ func BuildChunkMesh(game *load.Game, chunk *pkg.Chunk, chunkPos rl.Vector3) {
 	chunk.Indices = chunk.Indices[:0]
 	chunk.Colors = chunk.Colors[:0]
 	chunk.Normals = chunk.Normals[:0]
+	chunk.Translucent.Vertices = chunk.Translucent.Vertices[:0]
+	chunk.Translucent.Indices = chunk.Translucent.Indices[:0]
+	chunk.Translucent.Colors = chunk.Translucent.Colors[:0]
+	chunk.Translucent.Normals = chunk.Translucent.Normals[:0]
 	chunk.SpecialVoxels = chunk.SpecialVoxels[:0]
 
-	Nx, Ny, Nz := int(pkg.ChunkSize), int(pkg.WorldHeight), int(pkg.ChunkSize)
-
-	indexOffset := uint16(0)
+	Nx, Ny, Nz := int(pkg.ChunkSize), int(pkg.ChunkSize), int(pkg.ChunkSize)
 
 	// Tabela fixa de normais por face
 	faceNormals := [6][3]float32{
@@ -33,6 +35,15 @@ func BuildChunkMesh(game *load.Game, chunk *pkg.Chunk, chunkPos rl.Vector3) {
 	 * https://teotl.dev/vischunk/ (may be useful)
 	 * (AI was used to help the interpretation of some of those docs)
 	 */
+	// Block properties are resolved once per palette entry instead of once per voxel
+	palette := chunk.Voxels.Palette()
+	blocks := make([]world.BlockProperties, len(palette))
+	occludes := make([]bool, len(palette))
+	for i, voxel := range palette {
+		blocks[i] = world.Blocks.Get(voxel.Type)
+		occludes[i] = hidesFaces(blocks[i])
+	}
+
 	for i := 0; i < Nx*Ny*Nz; i++ {
 		pos := pkg.Coords{
 			X: i / (Ny * Nz),
@@ -40,36 +51,34 @@ func BuildChunkMesh(game *load.Game, chunk *pkg.Chunk, chunkPos rl.Vector3) {
 			Z: i % Nz,
 		}
 
-		voxel := chunk.Voxels[pos.X][pos.Y][pos.Z]
-		block := world.BlockTypes[voxel.Type]
+		index := chunk.Voxels.Index(pos.X, pos.Y, pos.Z)
+		voxel := palette[index]
+		block := blocks[index]
 
 		// Special cases → not included in the mesh, but they are kept
-		switch voxel.Type {
-		case "Plant":
+		switch block.RenderLayer {
+		case world.LayerNone:
+			continue
+		case world.LayerModel:
 			chunk.SpecialVoxels = append(chunk.SpecialVoxels, pkg.SpecialVoxel{
 				Position: pos,
 				Type:     voxel.Type,
-				Model:    voxel.Model,
+				Model:    pkg.PlantModels[voxel.ModelID],
 			})
 			continue
-		case "Water":
-			// only add if it's a surface
-			isSurface := true
-			if pos.Y+1 < pkg.WorldHeight {
-				above := chunk.Voxels[pos.X][pos.Y+1][pos.Z]
-				if above.Type == "Water" {
-					isSurface = false
+		case world.LayerTranslucent:
+			// liquids are only added at their surface, the other translucent blocks (ice) are meshed
+			if block.IsLiquid {
+				if voxelAbove(chunk, pos).Type != voxel.Type {
+					chunk.SpecialVoxels = append(chunk.SpecialVoxels, pkg.SpecialVoxel{
+						Position:  pos,
+						Type:      voxel.Type,
+						IsSurface: true,
+					})
 				}
+				continue
 			}
-			if isSurface {
-				chunk.SpecialVoxels = append(chunk.SpecialVoxels, pkg.SpecialVoxel{
-					Position:  pos,
-					Type:      voxel.Type,
-					IsSurface: true,
-				})
-			}
-			continue
-		case "Cloud":
+		case world.LayerSky:
 			chunk.SpecialVoxels = append(chunk.SpecialVoxels, pkg.SpecialVoxel{
 				Position: pos,
 				Type:     voxel.Type,
@@ -77,10 +86,6 @@ func BuildChunkMesh(game *load.Game, chunk *pkg.Chunk, chunkPos rl.Vector3) {
 			continue
 		}
 
-		if !block.IsSolid {
-			continue
-		}
-
 		c := voxel.Color
 		if c.R == 0 && c.G == 0 && c.B == 0 && c.A == 0 {
 			// fallback to default color if not set
@@ -93,10 +98,22 @@ func BuildChunkMesh(game *load.Game, chunk *pkg.Chunk, chunkPos rl.Vector3) {
 				(pos.Z*83492791 + pos.X*19349663) ^
 				(pos.Y*83492791 + pos.Z*73856093)) % 16)
 
+		// Translucent blocks go to a mesh of their own, drawn after the opaque ones
+		translucent := block.RenderLayer == world.LayerTranslucent
+		vertices, indices, colors, normals := &chunk.Vertices, &chunk.Indices, &chunk.Colors, &chunk.Normals
+		if translucent {
+			vertices, indices, colors, normals = &chunk.Translucent.Vertices, &chunk.Translucent.Indices, &chunk.Translucent.Colors, &chunk.Translucent.Normals
+		}
+
 		for face := 0; face < 6; face++ {
-			if !shouldDrawFace(chunk, pos, face) {
+			if !shouldDrawFace(chunk, occludes, pos, face) {
+				continue
+			}
+			// The faces between two blocks of the same translucent type aren't seen either
+			if translucent && voxelAhead(chunk, pos, face).Type == voxel.Type {
 				continue
 			}
+			indexOffset := uint16(len(*vertices) / 3)
 
 			nx, ny, nz := faceNormals[face][0], faceNormals[face][1], faceNormals[face][2]
 
@@ -115,7 +132,7 @@ func BuildChunkMesh(game *load.Game, chunk *pkg.Chunk, chunkPos rl.Vector3) {
 
 			for vertice := 0; vertice < 4; vertice++ {
 				v := pkg.FaceVertices[face][vertice]
-				chunk.Vertices = append(chunk.Vertices,
+				*vertices = append(*vertices,
 					float32(pos.X)+v[0],
 					float32(pos.Y)+v[1],
 					float32(pos.Z)+v[2],
@@ -134,51 +151,96 @@ func BuildChunkMesh(game *load.Game, chunk *pkg.Chunk, chunkPos rl.Vector3) {
 					)
 				*/
 
-				chunk.Colors = append(chunk.Colors, c.R+colorModifier, c.G+colorModifier, c.B+colorModifier, c.A)
+				*colors = append(*colors, c.R+colorModifier, c.G+colorModifier, c.B+colorModifier, c.A)
 
 				// add normal for each face vertex
-				chunk.Normals = append(chunk.Normals, nx, ny, nz)
+				*normals = append(*normals, nx, ny, nz)
 			}
 
 			//	Add the two triangles of the face
-			chunk.Indices = append(chunk.Indices,
+			*indices = append(*indices,
 				indexOffset, indexOffset+1, indexOffset+2,
 				indexOffset, indexOffset+2, indexOffset+3,
 			)
-			indexOffset += 4
 		}
 	}
 
+	model := loadChunkModel(game, pkg.MeshBuffers{
+		Vertices: chunk.Vertices,
+		Indices:  chunk.Indices,
+		Colors:   chunk.Colors,
+		Normals:  chunk.Normals,
+	})
+	var translucentModel rl.Model
+	if len(chunk.Translucent.Vertices) > 0 {
+		translucentModel = loadChunkModel(game, chunk.Translucent)
+	}
+
+	// Assign to chunk, the previous meshes are freed
+	unloadChunkModel(chunk)
+	chunk.Model = model
+	chunk.TranslucentModel = translucentModel
+	chunk.NeedsRemesh = false
+}
+
+// Uploads a mesh of a chunk, the model points to the buffers instead of copying them
+func loadChunkModel(game *load.Game, buffers pkg.MeshBuffers) rl.Model {
 	mesh := rl.Mesh{
-		VertexCount:   int32(len(chunk.Vertices) / 3),
-		TriangleCount: int32(len(chunk.Indices) / 3),
+		VertexCount:   int32(len(buffers.Vertices) / 3),
+		TriangleCount: int32(len(buffers.Indices) / 3),
 	}
 
-	if len(chunk.Vertices) > 0 {
-		mesh.Vertices = &chunk.Vertices[0]
+	if len(buffers.Vertices) > 0 {
+		mesh.Vertices = &buffers.Vertices[0]
 	}
-	if len(chunk.Indices) > 0 {
-		mesh.Indices = &chunk.Indices[0]
+	if len(buffers.Indices) > 0 {
+		mesh.Indices = &buffers.Indices[0]
 	}
-	if len(chunk.Colors) > 0 {
-		mesh.Colors = &chunk.Colors[0]
+	if len(buffers.Colors) > 0 {
+		mesh.Colors = &buffers.Colors[0]
 	}
-	if len(chunk.Normals) > 0 {
-		mesh.Normals = &chunk.Normals[0]
+	if len(buffers.Normals) > 0 {
+		mesh.Normals = &buffers.Normals[0]
 	}
 
 	rl.UploadMesh(&mesh, false)
 	model := rl.LoadModelFromMesh(mesh)
 
-	// Create material and assign it
-	material := rl.LoadMaterialDefault()
-	material.Shader = game.Shader
-	model.MaterialCount = 1
-	model.Materials = &material
+	// The default material of the model draws with the game shader
+	model.GetMaterials()[0].Shader = game.Shader
+	return model
+}
 
-	// Assign to chunk
-	chunk.Model = model
-	chunk.IsOutdated = false
+// Frees the meshes of a chunk on the GPU
+func unloadChunkModel(chunk *pkg.Chunk) {
+	unloadModel(&chunk.Model)
+	unloadModel(&chunk.TranslucentModel)
+}
+
+// rl.UnloadModel would also free the vertex data, which is Go memory owned by the chunk, so the
+// meshes are unloaded by rl.UnloadMesh first and cleared, then rl.UnloadModel only frees what
+// raylib allocated.
+func unloadModel(model *rl.Model) {
+	if model.Meshes == nil {
+		return
+	}
+	meshes := model.GetMeshes()
+	for i := range meshes {
+		rl.UnloadMesh(&meshes[i])
+		meshes[i] = rl.Mesh{}
+	}
+	rl.UnloadModel(*model)
+	*model = rl.Model{}
+}
+
+// Frees the meshes of the chunks that leave the world. Events are delivered on the main thread,
+// the one with the GPU context.
+func UnloadMeshes(events *world.Lifecycle) {
+	events.Subscribe(func(event world.ChunkEvent) {
+		if event.Chunk != nil && event.To == pkg.ChunkUnloading {
+			unloadChunkModel(event.Chunk)
+		}
+	})
 }
 
 func BuildCloudGreddyMesh(game *load.Game, chunk *pkg.Chunk) {
@@ -201,16 +263,16 @@ func BuildCloudGreddyMesh(game *load.Game, chunk *pkg.Chunk) {
 					continue
 				}
 
-				voxel := chunk.Voxels[x][y][z]
-				if voxel.Type != "Cloud" {
+				voxel := chunk.Voxels.Get(x, y, z)
+				if world.Blocks.Get(voxel.Type).RenderLayer != world.LayerSky {
 					continue
 				}
 
 				// tenta expandir retângulo na direção X
 				width := 1
 				for x+width < Nx {
-					next := chunk.Voxels[x+width][y][z]
-					if next.Type == "Cloud" && !used[y*Nx+(x+width)] {
+					next := chunk.Voxels.Get(x+width, y, z)
+					if next.Type == voxel.Type && !used[y*Nx+(x+width)] {
 						width++
 					} else {
 						break
@@ -232,7 +294,7 @@ func BuildCloudGreddyMesh(game *load.Game, chunk *pkg.Chunk) {
 
 				for _, v := range quad {
 					vertices = append(vertices, v[0], v[1], v[2])
-					c := world.BlockTypes["Cloud"].Color
+					c := world.Blocks.Get(voxel.Type).Color
 					colors = append(colors, c.R, c.G, c.B, c.A)
 				}
 
@@ -269,13 +331,18 @@ func BuildCloudGreddyMesh(game *load.Game, chunk *pkg.Chunk) {
 	model.Materials = &mat
 
 	//chunk.Model = model
-	chunk.IsOutdated = false
+	chunk.NeedsRemesh = false
 }
 
-func shouldDrawFace(chunk *pkg.Chunk, pos pkg.Coords, faceIndex int) bool {
+// A face is hidden when the voxel in front of it is solid and can't be seen through
+func hidesFaces(block world.BlockProperties) bool {
+	return block.IsSolid && !block.IsTransparent
+}
+
+// occludes tells, for each palette entry of the chunk, whether the voxel hides the faces next to it
+func shouldDrawFace(chunk *pkg.Chunk, occludes []bool, pos pkg.Coords, faceIndex int) bool {
 	direction := pkg.FaceDirections[faceIndex]
 	maxSize := int(pkg.ChunkSize - 1)
-	maxHeight := int(pkg.WorldHeight - 1)
 
 	// Calculates the new coordinates based on the face direction
 	nx := pos.X + int(direction.X)
@@ -284,48 +351,48 @@ func shouldDrawFace(chunk *pkg.Chunk, pos pkg.Coords, faceIndex int) bool {
 
 	// Case 1: Checks if the new coordinates are within the chunk bounds and does not render internal voxels
 	if nx >= 0 && nx <= maxSize &&
-		ny >= 0 && ny <= maxHeight &&
+		ny >= 0 && ny <= maxSize &&
 		nz >= 0 && nz <= maxSize {
-		voxelType := chunk.Voxels[nx][ny][nz].Type
-		return !world.BlockTypes[voxelType].IsSolid
-	}
-
-	// Case 2: vertical faces (do not have chunk neighbors)
-	if faceIndex == 2 {
-		// +Y (top)
-		return true
-	}
-	if faceIndex == 3 {
-		// -Y (bottom)
-		return false
-	}
-
-	// Case 3: Outside chunk boundries → depends on the neighbor
-	var neighborIdx int
-	switch faceIndex {
-	case 0:
-		neighborIdx = 0 // +X
-	case 1:
-		neighborIdx = 1 // -X
-	case 4:
-		neighborIdx = 2 // +Z
-	case 5:
-		neighborIdx = 3 // -Z
+		return !occludes[chunk.Voxels.Index(nx, ny, nz)]
 	}
 
-	neighbor := chunk.Neighbors[neighborIdx]
+	// Case 2: Outside chunk boundries → depends on the neighbor (Neighbors follows the order of FaceDirections)
+	neighbor := chunk.Neighbors[faceIndex]
 	if neighbor == nil {
-		return true // no neighbor → exposed face
+		// The bottom of the world is never seen
+		if faceIndex == 3 && chunk.Column != nil && chunk.Coord.Y == chunk.Column.MinSection {
+			return false
+		}
+		return true // empty or not loaded neighbor → exposed face
 	}
 
 	// Adjusts coordinates relative to the neighbor.
 	nx = (nx + int(pkg.ChunkSize)) % int(pkg.ChunkSize)
+	ny = (ny + int(pkg.ChunkSize)) % int(pkg.ChunkSize)
 	nz = (nz + int(pkg.ChunkSize)) % int(pkg.ChunkSize)
 
-	if ny < 0 || ny > maxHeight {
-		return true
-	}
+	voxelType := neighbor.Voxels.Get(nx, ny, nz).Type
+	return !hidesFaces(world.Blocks.Get(voxelType))
+}
+
+// Returns the voxel right above a position, looking into the chunk above when needed
+func voxelAbove(chunk *pkg.Chunk, pos pkg.Coords) pkg.VoxelData {
+	return voxelAhead(chunk, pos, 2)
+}
+
+// Returns the voxel in front of a face of a position, looking into the neighbor when needed
+// (air when the neighbor is empty or not loaded)
+func voxelAhead(chunk *pkg.Chunk, pos pkg.Coords, faceIndex int) pkg.VoxelData {
+	direction := pkg.FaceDirections[faceIndex]
+	nx := pos.X + int(direction.X)
+	ny := pos.Y + int(direction.Y)
+	nz := pos.Z + int(direction.Z)
 
-	voxelType := neighbor.Voxels[nx][ny][nz].Type
-	return !world.BlockTypes[voxelType].IsSolid
+	if nx >= 0 && nx < pkg.ChunkSize && ny >= 0 && ny < pkg.ChunkSize && nz >= 0 && nz < pkg.ChunkSize {
+		return chunk.Voxels.Get(nx, ny, nz)
+	}
+	if neighbor := chunk.Neighbors[faceIndex]; neighbor != nil {
+		return neighbor.Voxels.Get((nx+pkg.ChunkSize)%pkg.ChunkSize, (ny+pkg.ChunkSize)%pkg.ChunkSize, (nz+pkg.ChunkSize)%pkg.ChunkSize)
+	}
+	return pkg.VoxelData{}
 }
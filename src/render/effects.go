@@ -35,7 +35,7 @@ func calculateVoxelAO(chunk *pkg.Chunk, pos pkg.Coords, face int, corner int) fl
 		if nx >= 0 && nx < pkg.ChunkSize &&
 			ny >= 0 && ny < pkg.ChunkSize &&
 			nz >= 0 && nz < pkg.ChunkSize {
-			if world.BlockTypes[chunk.Voxels[nx][ny][nz].Type].IsSolid {
+			if world.Blocks.Get(chunk.Voxels.Get(nx, ny, nz).Type).IsSolid {
 				occlusion++
 			}
 		} else {
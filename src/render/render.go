@@ -18,45 +18,59 @@ var ShowMenu bool = false
 var ShowFPS bool = true
 var ShowPosition bool = true
 var ShowClouds bool = true
+var ShowChunkStates bool = false
 
 var menuScroll rl.Vector2
 var menuView rl.Rectangle
 
+// Runs on the main thread, the only one that changes loaded chunks, so it reads them without
+// the lock (see world.ChunkCache)
 func RenderVoxels(game *load.Game) {
 	cam := game.Camera.Position
 
 	rl.SetShaderValue(game.Shader, rl.GetShaderLocation(game.Shader, "viewPos"), []float32{cam.X, cam.Y, cam.Z}, rl.ShaderUniformVec3)
 
-	// --- Round 1: solids ---
+	// Only the chunks within the view distance are drawn, the finished columns further away
+	// are there for the stages of the ones inside
+	drawn := make(map[pkg.Coords]*pkg.Chunk)
 	for coord, chunk := range game.ChunkCache.Active {
+		if world.InRenderDistance(coord, cam) {
+			drawn[coord] = chunk
+		} else if chunk.State == pkg.ChunkVisible {
+			game.ChunkCache.Transition(chunk, pkg.ChunkMeshed)
+		}
+	}
+
+	// --- Round 1: solids ---
+	for coord, chunk := range drawn {
 		// Converts chunk coordinate to actual position
-		chunkPos := rl.NewVector3(
-			float32(coord.X*pkg.ChunkSize),
-			0,
-			float32(coord.Z*pkg.ChunkSize),
-		)
+		chunkPos := world.ChunkOrigin(coord)
 
-		if chunk.IsOutdated {
+		if chunk.NeedsRemesh {
 			BuildChunkMesh(game, chunk, chunkPos)
-			chunk.IsOutdated = false // reset flag → do not rebuild each frame
+			chunk.NeedsRemesh = false // reset flag → do not rebuild each frame
+			if chunk.State == pkg.ChunkDecorated {
+				game.ChunkCache.Transition(chunk, pkg.ChunkMeshed)
+			}
 		}
 
 		// If the chunk has mesh, draw directly
 		if chunk.Model.MeshCount > 0 && chunk.Model.Meshes != nil {
 			rl.DrawModel(chunk.Model, chunkPos, 1.0, rl.White)
+			if chunk.State == pkg.ChunkMeshed {
+				game.ChunkCache.Transition(chunk, pkg.ChunkVisible)
+			}
+		} else if chunk.State == pkg.ChunkVisible {
+			game.ChunkCache.Transition(chunk, pkg.ChunkMeshed)
 		}
 	}
 
 	// --- Passage 2: plants per chunk (without global sorting) ---
-	for coord, chunk := range game.ChunkCache.Active {
-		chunkPos := rl.NewVector3(
-			float32(coord.X*pkg.ChunkSize),
-			0,
-			float32(coord.Z*pkg.ChunkSize),
-		)
+	for coord, chunk := range drawn {
+		chunkPos := world.ChunkOrigin(coord)
 
 		for _, voxel := range chunk.SpecialVoxels {
-			if voxel.Type == "Plant" {
+			if world.Blocks.Get(voxel.Type).RenderLayer == world.LayerModel {
 				pos := rl.NewVector3(
 					chunkPos.X+float32(voxel.Position.X),
 					chunkPos.Y+float32(voxel.Position.Y),
@@ -69,12 +83,8 @@ func RenderVoxels(game *load.Game) {
 	// --- Global collection of transparencies ---
 	var transparentItems []pkg.TransparentItem
 
-	for coord, chunk := range game.ChunkCache.Active {
-		chunkPos := rl.NewVector3(
-			float32(coord.X*pkg.ChunkSize),
-			0,
-			float32(coord.Z*pkg.ChunkSize),
-		)
+	for coord, chunk := range drawn {
+		chunkPos := world.ChunkOrigin(coord)
 
 		for _, voxel := range chunk.SpecialVoxels {
 			pos := rl.NewVector3(
@@ -83,17 +93,19 @@ func RenderVoxels(game *load.Game) {
 				chunkPos.Z+float32(voxel.Position.Z),
 			)
 
+			block := world.Blocks.Get(voxel.Type)
+
 			transparentItems = append(transparentItems, pkg.TransparentItem{
 				Position:       pos,
 				Type:           voxel.Type,
-				Color:          world.BlockTypes[voxel.Type].Color,
-				IsSurfaceWater: voxel.Type == "Water" && voxel.IsSurface,
+				Color:          block.Color,
+				IsSurfaceWater: block.IsLiquid && voxel.IsSurface,
 			})
 		}
 	}
 
 	// --- Back-to-front sorting ---
-	if game.Camera.Position.Y >= float32(pkg.CloudHeight) {
+	if game.Camera.Position.Y >= float32(game.Generator.World.CloudHeight()) {
 		sort.Slice(transparentItems, func(i, j int) bool {
 			di := rl.Vector3Length(rl.Vector3Subtract(transparentItems[i].Position, cam))
 			dj := rl.Vector3Length(rl.Vector3Subtract(transparentItems[j].Position, cam))
@@ -104,10 +116,31 @@ func RenderVoxels(game *load.Game) {
 	// --- Round 3: transparent ---
 	rl.SetBlendMode(rl.BlendAlpha)
 	rl.DisableDepthMask()
+
+	// Meshes of the translucent blocks (ice), the furthest chunks first
+	var translucent []pkg.Coords
+	for coord, chunk := range drawn {
+		if chunk.TranslucentModel.Meshes != nil {
+			translucent = append(translucent, coord)
+		}
+	}
+	center := func(coord pkg.Coords) rl.Vector3 {
+		half := float32(pkg.ChunkSize) / 2
+		return rl.Vector3Add(world.ChunkOrigin(coord), rl.NewVector3(half, half, half))
+	}
+	sort.Slice(translucent, func(i, j int) bool {
+		di := rl.Vector3Length(rl.Vector3Subtract(center(translucent[i]), cam))
+		dj := rl.Vector3Length(rl.Vector3Subtract(center(translucent[j]), cam))
+		return di > dj
+	})
+	for _, coord := range translucent {
+		rl.DrawModel(drawn[coord].TranslucentModel, world.ChunkOrigin(coord), 1.0, rl.White)
+	}
+
 	//rl.BeginShaderMode(game.Shader)
 	for _, it := range transparentItems {
-		switch it.Type {
-		case "Water":
+		switch world.Blocks.Get(it.Type).RenderLayer {
+		case world.LayerTranslucent:
 			p := rl.NewVector3(it.Position.X+0.5, it.Position.Y+0.5, it.Position.Z+0.5)
 
 			/*
@@ -116,8 +149,11 @@ func RenderVoxels(game *load.Game) {
 				litColor := applyLighting(it.Color, lightIntensity)
 			*/
 
-			rl.DrawPlane(p, rl.NewVector2(1.0, 1.0), it.Color)
-		case "Cloud":
+			// Liquids only show their surface, the other translucent blocks are in the chunk meshes
+			if it.IsSurfaceWater {
+				rl.DrawPlane(p, rl.NewVector2(1.0, 1.0), it.Color)
+			}
+		case world.LayerSky:
 			/*
 				lightIntensity := calculateLightIntensity(it.Position, game.LightPosition)
 				litColor := applyLighting(it.Color, lightIntensity)
@@ -231,22 +267,22 @@ func RenderVoxels(game *load.Game) {
 */
 
 func applyUnderwaterEffect(game *load.Game) {
-	waterLevel := int(float64(pkg.WorldHeight)*pkg.WaterLevelFraction) + 1
+	waterLevel := game.Generator.World.WaterLevel() + 1
 
 	coord := world.ToChunkCoord(game.Camera.Position)
 	chunk := game.ChunkCache.Active[coord]
 
 	if chunk != nil {
 		localX := int(game.Camera.Position.X) - coord.X*pkg.ChunkSize
-		localY := int(game.Camera.Position.Y) - coord.Y*pkg.WorldHeight
+		localY := int(game.Camera.Position.Y) - coord.Y*pkg.ChunkSize
 		localZ := int(game.Camera.Position.Z) - coord.Z*pkg.ChunkSize
 
 		if localX >= 0 && localX < pkg.ChunkSize &&
-			localY >= 0 && localY < pkg.WorldHeight &&
+			localY >= 0 && localY < pkg.ChunkSize &&
 			localZ >= 0 && localZ < pkg.ChunkSize {
 
-			voxel := chunk.Voxels[localX][localY][localZ]
-			if voxel.Type == "Water" && game.Camera.Position.Y < float32(waterLevel)-0.5 {
+			voxel := chunk.Voxels.Get(localX, localY, localZ)
+			if world.Blocks.Get(voxel.Type).IsLiquid && game.Camera.Position.Y < float32(waterLevel)-0.5 {
 				// apply blue overlay
 				rl.SetBlendMode(rl.BlendMode(0))
 				rl.DrawRectangle(0, 0, int32(rl.GetScreenWidth()), int32(rl.GetScreenHeight()), rl.NewColor(0, 0, 255, 100))
@@ -295,6 +331,10 @@ func RenderGame(game *load.Game) {
 		rl.DrawText(positionText, 10, 5, 20, rl.DarkGreen)
 	}
 
+	if ShowChunkStates {
+		rl.DrawText(game.ChunkStats.String(), 10, 55, 20, rl.DarkGreen)
+	}
+
 	rl.EndDrawing()
 }
 
@@ -319,6 +359,8 @@ func renderMenu(menuX, menuY, width int32) {
 		fmt.Sprintf("View Distance: %d", pkg.ChunkDistance),
 	)
 
+	newButton(menuX+20, menuY+280+offsetY, float32(width-40), 40.0, &ShowChunkStates, "Show Chunk States")
+
 	//newGuiSlider(menuX+20, menuY+290, float32(menuWidth-40), 40.0, &load.FogCoefficient, 0.0, 1.0, fmt.Sprintf("Fog Density: %.3f", load.FogCoefficient))
 
 	rl.EndScissorMode()
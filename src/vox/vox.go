@@ -0,0 +1,206 @@
+// Package vox reads MagicaVoxel .vox files.
+// It only depends on the standard library, so models can be loaded without a window or a GPU.
+//
+// File layout: "VOX " + version, then a MAIN chunk whose children are the model chunks
+// (SIZE followed by XYZI for every model) and an optional RGBA palette.
+// Every chunk is: id (4 bytes), content size, children size, content, children.
+// Chunks we don't use (transforms, materials, layers...) are skipped.
+package vox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"io/fs"
+)
+
+type Voxel struct {
+	X, Y, Z uint8 // z is up in MagicaVoxel
+	Color   uint8 // palette index, 1-255
+}
+
+type Model struct {
+	Size   [3]int // x, y, z
+	Voxels []Voxel
+}
+
+type File struct {
+	Version int
+	Models  []Model
+	Palette [256]color.RGBA // index 0 is unused (empty voxel)
+}
+
+// Color of a palette index
+func (f *File) Color(index uint8) color.RGBA {
+	return f.Palette[index]
+}
+
+// Reads a .vox file from a file system (os.DirFS, embed.FS...)
+func Load(fsys fs.FS, path string) (*File, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, nil
+}
+
+func Decode(r io.Reader) (*File, error) {
+	var header struct {
+		Magic   [4]byte
+		Version int32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if string(header.Magic[:]) != "VOX " {
+		return nil, errors.New("not a .vox file")
+	}
+
+	id, content, children, err := readChunk(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != "MAIN" {
+		return nil, fmt.Errorf("expected the MAIN chunk, found %q", id)
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(content)); err != nil {
+		return nil, err
+	}
+
+	file := &File{Version: int(header.Version), Palette: defaultPalette()}
+	body := io.LimitReader(r, int64(children))
+
+	var size [3]int
+	hasSize := false
+	for {
+		id, content, children, err := readChunk(body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, content)
+		if _, err := io.ReadFull(body, data); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", id, err)
+		}
+		if _, err := io.CopyN(io.Discard, body, int64(children)); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", id, err)
+		}
+
+		switch id {
+		case "SIZE":
+			if len(data) < 12 {
+				return nil, errors.New("SIZE chunk is too short")
+			}
+			for i := range 3 {
+				size[i] = int(int32(binary.LittleEndian.Uint32(data[i*4:])))
+			}
+			hasSize = true
+
+		case "XYZI":
+			if !hasSize {
+				return nil, errors.New("XYZI chunk without a SIZE before it")
+			}
+			if len(data) < 4 {
+				return nil, errors.New("XYZI chunk is too short")
+			}
+			count := int(binary.LittleEndian.Uint32(data))
+			if count < 0 || len(data) < 4+count*4 {
+				return nil, fmt.Errorf("XYZI chunk has %d voxels but only %d bytes", count, len(data))
+			}
+
+			model := Model{Size: size, Voxels: make([]Voxel, count)}
+			for i := range count {
+				v := data[4+i*4:]
+				if int(v[0]) >= size[0] || int(v[1]) >= size[1] || int(v[2]) >= size[2] {
+					return nil, fmt.Errorf("voxel %d, %d, %d is outside the model size %v", v[0], v[1], v[2], size)
+				}
+				model.Voxels[i] = Voxel{X: v[0], Y: v[1], Z: v[2], Color: v[3]}
+			}
+			file.Models = append(file.Models, model)
+			hasSize = false
+
+		case "RGBA":
+			if len(data) < 256*4 {
+				return nil, errors.New("RGBA chunk is too short")
+			}
+			// Color i of the chunk is palette index i+1, the last one is unused
+			for i := range 255 {
+				c := data[i*4:]
+				file.Palette[i+1] = color.RGBA{R: c[0], G: c[1], B: c[2], A: c[3]}
+			}
+		}
+	}
+
+	if len(file.Models) == 0 {
+		return nil, errors.New("the file has no models")
+	}
+	return file, nil
+}
+
+func readChunk(r io.Reader) (id string, content, children int32, err error) {
+	var header struct {
+		ID       [4]byte
+		Content  int32
+		Children int32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		if err == io.EOF {
+			return "", 0, 0, io.EOF
+		}
+		return "", 0, 0, fmt.Errorf("reading chunk header: %w", err)
+	}
+	if header.Content < 0 || header.Children < 0 {
+		return "", 0, 0, fmt.Errorf("chunk %q has a negative size", header.ID[:])
+	}
+	return string(header.ID[:]), header.Content, header.Children, nil
+}
+
+// Palette used by files without an RGBA chunk: a 6x6x6 color cube (without black)
+// followed by red, green, blue and gray ramps
+func defaultPalette() [256]color.RGBA {
+	var palette [256]color.RGBA
+
+	i := 1
+	steps := []uint8{0xff, 0xcc, 0x99, 0x66, 0x33, 0x00}
+	for _, r := range steps {
+		for _, g := range steps {
+			for _, b := range steps {
+				if r == 0 && g == 0 && b == 0 {
+					continue
+				}
+				palette[i] = color.RGBA{R: r, G: g, B: b, A: 0xff}
+				i++
+			}
+		}
+	}
+
+	ramp := []uint8{0xee, 0xdd, 0xbb, 0xaa, 0x88, 0x77, 0x55, 0x44, 0x22, 0x11}
+	for channel := range 4 {
+		for _, v := range ramp {
+			c := color.RGBA{A: 0xff}
+			switch channel {
+			case 0:
+				c.R = v
+			case 1:
+				c.G = v
+			case 2:
+				c.B = v
+			case 3:
+				c.R, c.G, c.B = v, v, v
+			}
+			palette[i] = c
+			i++
+		}
+	}
+	return palette
+}
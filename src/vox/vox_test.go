@@ -0,0 +1,152 @@
+package vox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+// The plants shipped with the game
+func TestBundledModels(t *testing.T) {
+	assets := os.DirFS("../../assets")
+	files, err := fs.Glob(assets, "plants/*.vox")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no .vox files found: %v", err)
+	}
+
+	for _, path := range files {
+		file, err := Load(assets, path)
+		if err != nil {
+			t.Errorf("%v", err)
+			continue
+		}
+		if len(file.Models) != 1 {
+			t.Errorf("%s: %d models, expected 1", path, len(file.Models))
+		}
+
+		model := file.Models[0]
+		if model.Size != [3]int{7, 7, 7} {
+			t.Errorf("%s: size %v, expected 7x7x7", path, model.Size)
+		}
+		if len(model.Voxels) == 0 {
+			t.Errorf("%s: no voxels", path)
+		}
+		for _, v := range model.Voxels {
+			if v.Color == 0 {
+				t.Errorf("%s: voxel %d, %d, %d uses the empty color", path, v.X, v.Y, v.Z)
+			}
+			if file.Color(v.Color).A == 0 {
+				t.Errorf("%s: voxel %d, %d, %d is transparent", path, v.X, v.Y, v.Z)
+			}
+		}
+	}
+}
+
+type chunk struct {
+	id       string
+	content  []byte
+	children []byte
+}
+
+func (c chunk) bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(c.id)
+	binary.Write(&buf, binary.LittleEndian, int32(len(c.content)))
+	binary.Write(&buf, binary.LittleEndian, int32(len(c.children)))
+	buf.Write(c.content)
+	buf.Write(c.children)
+	return buf.Bytes()
+}
+
+func encode(chunks ...chunk) []byte {
+	var children []byte
+	for _, c := range chunks {
+		children = append(children, c.bytes()...)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("VOX ")
+	binary.Write(&buf, binary.LittleEndian, int32(150))
+	buf.Write(chunk{id: "MAIN", children: children}.bytes())
+	return buf.Bytes()
+}
+
+func sizeChunk(x, y, z int32) chunk {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, [3]int32{x, y, z})
+	return chunk{id: "SIZE", content: buf.Bytes()}
+}
+
+func xyziChunk(voxels ...Voxel) chunk {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, int32(len(voxels)))
+	for _, v := range voxels {
+		buf.Write([]byte{v.X, v.Y, v.Z, v.Color})
+	}
+	return chunk{id: "XYZI", content: buf.Bytes()}
+}
+
+func TestMultipleModels(t *testing.T) {
+	data := encode(
+		chunk{id: "PACK", content: []byte{2, 0, 0, 0}},
+		sizeChunk(2, 2, 2),
+		xyziChunk(Voxel{0, 0, 0, 1}, Voxel{1, 1, 1, 216}),
+		sizeChunk(3, 1, 1),
+		xyziChunk(Voxel{2, 0, 0, 255}),
+		chunk{id: "nTRN", content: []byte{1, 2, 3}}, // unknown chunks are skipped
+	)
+
+	file, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Models) != 2 {
+		t.Fatalf("%d models, expected 2", len(file.Models))
+	}
+	if file.Models[0].Size != [3]int{2, 2, 2} || len(file.Models[0].Voxels) != 2 {
+		t.Errorf("first model: %+v", file.Models[0])
+	}
+	if file.Models[1].Size != [3]int{3, 1, 1} || file.Models[1].Voxels[0] != (Voxel{2, 0, 0, 255}) {
+		t.Errorf("second model: %+v", file.Models[1])
+	}
+
+	// No RGBA chunk: the default palette is used
+	if c := file.Color(1); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("default color 1 is %v, expected white", c)
+	}
+	if c := file.Color(255); c != (color.RGBA{0x11, 0x11, 0x11, 255}) {
+		t.Errorf("default color 255 is %v, expected dark gray", c)
+	}
+}
+
+func TestPaletteChunk(t *testing.T) {
+	palette := make([]byte, 256*4)
+	copy(palette, []byte{10, 20, 30, 255})
+	data := encode(sizeChunk(1, 1, 1), xyziChunk(Voxel{0, 0, 0, 1}), chunk{id: "RGBA", content: palette})
+
+	file, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := file.Color(1); c != (color.RGBA{10, 20, 30, 255}) {
+		t.Errorf("color 1 is %v, expected the first color of the chunk", c)
+	}
+}
+
+func TestInvalidFiles(t *testing.T) {
+	files := map[string][]byte{
+		"wrong magic":        append([]byte("PNG "), encode(sizeChunk(1, 1, 1))[4:]...),
+		"no models":          encode(),
+		"xyzi without size":  encode(xyziChunk(Voxel{0, 0, 0, 1})),
+		"voxel outside size": encode(sizeChunk(1, 1, 1), xyziChunk(Voxel{1, 0, 0, 1})),
+		"truncated":          encode(sizeChunk(2, 2, 2), xyziChunk(Voxel{0, 0, 0, 1}))[:40],
+	}
+
+	for name, data := range files {
+		if _, err := Decode(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -1,60 +1,154 @@
 package world
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
 	"math"
 	"math/rand"
+	"sync"
 
+	"go-engine/assets"
+	"go-engine/src/noise"
 	"go-engine/src/pkg"
 
-	"github.com/aquilax/go-perlin"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
-var BiomeTypes = map[string]*pkg.BiomeProperties{
-	"Meadow": {
-		Modifier:         meadowModifier,
-		SurfaceBlock:     "Grass",
-		UndergroundBlock: "Dirt",
-		TreeTypes: []string{
-			"F=F[FA(3)L][FA(3)L][FA(3)L]A(3)",
-			"F=F[F+A(5)L][−A(5)L][/A(4)L][\\A(4)L]",
-			"F=F[A(3)L]F[-A(2)L]F[/A(2)L]F[+A(1)L]",
-			"F=FFF[FA(2)L][FA(3)L][FA(4)L]",
-		},
-		TreeDensity: 0.2,
-		GrassColor:  rl.NewColor(72, 174, 34, 255), // verde vivo
-		LeavesColor: rl.NewColor(73, 129, 49, 255), // verde escuro
-	},
-	"Birchwood": {
-		Modifier:         birchwoodModifier,
-		SurfaceBlock:     "Grass",
-		UndergroundBlock: "Dirt",
-		TreeTypes: []string{
-			"F=F[-A(2)L]F[/A(2)L]F[+A(1)L]",
-			"F=FF[FA(2)L][FA(3)L][FA(4)L]",
-			"F=F[+A(2)L][-A(2)L]FL",
-		},
-		TreeDensity: 0.4,
-		GrassColor:  rl.NewColor(69, 143, 72, 255),
-		LeavesColor: rl.NewColor(53, 105, 56, 255),
-	},
-	"Savanna": {
-		Modifier:         savannaModifier,
-		SurfaceBlock:     "Grass",
-		UndergroundBlock: "Dirt",
-		TreeTypes: []string{
-			"F=F[FA(3)L][FA(3)L][FA(3)L]A(3)",
-			"F=F[+FA(4)L][-A(4)L][\\A(4)L]",
-		},
-		TreeDensity: 0.2,
-		GrassColor:  rl.NewColor(134, 157, 36, 255),
-		LeavesColor: rl.NewColor(102, 119, 23, 255),
-	},
-	"Desert": {
-		Modifier:         desertModifier,
-		SurfaceBlock:     "Sand",
-		UndergroundBlock: "Sand",
-	},
+// Every biome of the game, loaded from assets/data/biomes.json
+var Biomes = mustLoadDefaultBiomes()
+
+// Biome definition as it is written in the data file
+type biomeDefinition struct {
+	Name              string            `json:"name"`
+	SurfaceBlock      string            `json:"surfaceBlock"`
+	UndergroundBlock  string            `json:"undergroundBlock"`
+	FillerDepth       int               `json:"fillerDepth"`
+	GrassColor        [4]uint8          `json:"grassColor"`
+	LeavesColor       [4]uint8          `json:"leavesColor"`
+	TreeTypes         []string          `json:"treeTypes"` // names of tree species
+	TreeDensity       float32           `json:"treeDensity"`
+	VegetationDensity float32           `json:"vegetationDensity"`
+	Climate           pkg.ClimateRange  `json:"climate"`
+	Caves             *pkg.CaveSettings `json:"caves"`
+	Frozen            bool              `json:"frozen"`      // water surface turns to ice
+	Sea               string            `json:"sea"`         // beach, ocean or deepOcean: picked by the continentalness, not by the cells
+	FloorBlocks       []string          `json:"floorBlocks"` // sea floor blocks
+	Height            struct {
+		Scale  float64          `json:"scale"`
+		Layers []pkg.NoiseLayer `json:"layers"`
+	} `json:"height"`
+}
+
+type BiomeRegistry struct {
+	biomes []*pkg.BiomeProperties // in the order of the data file, which keeps the biome selection deterministic
+	byName map[string]*pkg.BiomeProperties
+}
+
+func mustLoadDefaultBiomes() *BiomeRegistry {
+	registry, err := LoadBiomeRegistry(assets.Data, "data/biomes.json")
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// Loads the biome definitions. The blocks and trees they use must already be in Blocks and Trees.
+func LoadBiomeRegistry(fsys fs.FS, path string) (*BiomeRegistry, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Biomes []biomeDefinition `json:"biomes"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	registry := &BiomeRegistry{byName: make(map[string]*pkg.BiomeProperties)}
+
+	for _, def := range file.Biomes {
+		if _, ok := registry.byName[def.Name]; ok {
+			return nil, fmt.Errorf("%s: biome %q is defined twice", path, def.Name)
+		}
+		for _, block := range append([]string{def.SurfaceBlock, def.UndergroundBlock}, def.FloorBlocks...) {
+			if _, ok := Blocks.Lookup(block); !ok {
+				return nil, fmt.Errorf("%s: biome %q uses unknown block %q", path, def.Name, block)
+			}
+		}
+		switch def.Sea {
+		case "", SeaBeach, SeaOcean, SeaDeep:
+		default:
+			return nil, fmt.Errorf("%s: biome %q has unknown sea kind %q", path, def.Name, def.Sea)
+		}
+		for _, layer := range def.Height.Layers {
+			if layer.Source != "primary" && layer.Source != "secondary" {
+				return nil, fmt.Errorf("%s: biome %q has unknown noise source %q", path, def.Name, layer.Source)
+			}
+		}
+
+		// Missing climate ranges accept any value
+		for _, limits := range []*[2]float64{&def.Climate.Temperature, &def.Climate.Humidity, &def.Climate.Continentalness, &def.Climate.Altitude} {
+			if *limits == [2]float64{} {
+				*limits = [2]float64{0, 1}
+			}
+		}
+
+		var trees []*pkg.TreeSpecies
+		for _, name := range def.TreeTypes {
+			species, ok := Trees.Get(name)
+			if !ok {
+				return nil, fmt.Errorf("%s: biome %q uses unknown tree %q", path, def.Name, name)
+			}
+			trees = append(trees, species)
+		}
+
+		// Biomes without cave settings get the default amount of every kind
+		caves := pkg.CaveSettings{Cheese: 1, Spaghetti: 1, Noodle: 1}
+		if def.Caves != nil {
+			caves = *def.Caves
+		}
+
+		biome := &pkg.BiomeProperties{
+			Name:              def.Name,
+			Climate:           def.Climate,
+			HeightScale:       def.Height.Scale,
+			HeightLayers:      def.Height.Layers,
+			SurfaceBlock:      def.SurfaceBlock,
+			UndergroundBlock:  def.UndergroundBlock,
+			FillerDepth:       def.FillerDepth,
+			TreeTypes:         trees,
+			TreeDensity:       def.TreeDensity,
+			VegetationDensity: def.VegetationDensity,
+			Caves:             caves,
+			Frozen:            def.Frozen,
+			Sea:               def.Sea,
+			FloorBlocks:       def.FloorBlocks,
+			GrassColor:        rl.NewColor(def.GrassColor[0], def.GrassColor[1], def.GrassColor[2], def.GrassColor[3]),
+			LeavesColor:       rl.NewColor(def.LeavesColor[0], def.LeavesColor[1], def.LeavesColor[2], def.LeavesColor[3]),
+		}
+
+		registry.biomes = append(registry.biomes, biome)
+		registry.byName[def.Name] = biome
+	}
+
+	if len(registry.biomes) == 0 {
+		return nil, fmt.Errorf("%s: no biomes defined", path)
+	}
+
+	return registry, nil
+}
+
+func (r *BiomeRegistry) Get(name string) (*pkg.BiomeProperties, bool) {
+	biome, ok := r.byName[name]
+	return biome, ok
+}
+
+// Every biome, in the order of the data file
+func (r *BiomeRegistry) All() []*pkg.BiomeProperties {
+	return r.biomes
 }
 
 type Cell struct {
@@ -103,45 +197,232 @@ func (w *WorleyNoise) Evaluate(x, z int) (float64, float64, int, int, int, int)
 	return d1, d2, nearestX, nearestZ, secondX, secondZ
 }
 
+const (
+	// Frequency of the climate fields, they change over several biome cells
+	climateFrequency = 0.0015
+
+	// Middle of the temperature scale. Biomes whose temperature range covers it are temperate,
+	// the others are cold or hot (see biomeBand), and cold and hot cells are never placed next to each other.
+	temperateTemperature = 0.5
+)
+
+// Climate at a position, every value is in [0, 1]
+type Climate struct {
+	Temperature     float64
+	Humidity        float64
+	Continentalness float64 // 0: deep ocean, 1: far inland
+	Altitude        float64 // global terrain height
+}
+
+// Picks the biome of each Worley cell from the climate at its feature point
 type BiomeSelector struct {
-	Seed     int64
-	CellSize int
+	Seed            int64
+	CellSize        int
+	temperature     noise.Source
+	humidity        noise.Source
+	continentalness noise.Source
+	height          noise.Source // the same noise that shapes the global terrain height
+	worley          *WorleyNoise
+	cells           sync.Map // [2]int → *pkg.BiomeProperties, biomes are looked up for every column
+	candidates      sync.Map // [2]int → *pkg.BiomeProperties, the biome of a cell before its neighbors are checked
 }
 
-func NewBiomeSelector(seed int64, cellSize int) *BiomeSelector {
-	return &BiomeSelector{Seed: seed, CellSize: cellSize}
+// worley must be the same noise that splits the terrain in biome cells
+func NewBiomeSelector(seed int64, worley *WorleyNoise, height noise.Source) *BiomeSelector {
+	return &BiomeSelector{
+		Seed:            seed,
+		CellSize:        worley.CellSize,
+		temperature:     baseNoise(noise.DeriveSeed(seed, 10), climateFrequency),
+		humidity:        baseNoise(noise.DeriveSeed(seed, 11), climateFrequency),
+		continentalness: baseNoise(noise.DeriveSeed(seed, 12), climateFrequency),
+		height:          height,
+		worley:          worley,
+	}
 }
 
-func (b *BiomeSelector) biomeForCell(cellX, cellZ int) *pkg.BiomeProperties {
+// Returns the climate at a world position (used by the biome selection, and by weather or grass tint)
+func (b *BiomeSelector) Climate(gx, gz int) Climate {
+	x, z := float64(gx), float64(gz)
+
+	climate := Climate{
+		Temperature:     climateValue(b.temperature.Noise2D(x, z)),
+		Humidity:        climateValue(b.humidity.Noise2D(x, z)),
+		Continentalness: b.Continentalness(gx, gz),
+		Altitude:        globalHeight(gx, gz, b.height),
+	}
+
+	// Higher places are colder
+	if climate.Altitude > 0.6 {
+		climate.Temperature = math.Max(0, climate.Temperature-(climate.Altitude-0.6))
+	}
+	return climate
+}
+
+// 0 in the deep ocean, 1 far inland. The coasts follow it (see shapeSea).
+func (b *BiomeSelector) Continentalness(gx, gz int) float64 {
+	return climateValue(b.continentalness.Noise2D(float64(gx), float64(gz)))
+}
+
+// Noise values rarely reach ±1, so they are stretched before being mapped to [0, 1]
+func climateValue(n float64) float64 {
+	return math.Max(0, math.Min(1, (n*1.5+1)/2))
+}
+
+// Temperature band of a biome, taken from its temperature range in the data: temperate (0) when
+// it covers the middle of the scale, otherwise cold (-1) or hot (1)
+func biomeBand(biome *pkg.BiomeProperties) int {
+	switch limits := biome.Climate.Temperature; {
+	case limits[1] < temperateTemperature:
+		return -1
+	case limits[0] > temperateTemperature:
+		return 1
+	}
+	return 0
+}
+
+// Climate at the feature point of a cell
+func (b *BiomeSelector) cellClimate(cellX, cellZ int) Climate {
+	fx, fz := b.worley.featurePoint(cellX, cellZ)
+	return b.Climate(int(fx), int(fz))
+}
+
+// Random source of a cell, for the ties between biomes
+func (b *BiomeSelector) cellRand(cellX, cellZ int) *rand.Rand {
 	h := int64(cellX*83492791^cellZ*1234567) ^ b.Seed
-	r := rand.New(rand.NewSource(h))
+	return rand.New(rand.NewSource(h))
+}
+
+// Biome that fits the climate of a cell, without looking at its neighbors
+func (b *BiomeSelector) candidate(cellX, cellZ int) *pkg.BiomeProperties {
+	key := [2]int{cellX, cellZ}
+	if biome, ok := b.candidates.Load(key); ok {
+		return biome.(*pkg.BiomeProperties)
+	}
+	biome := matchBiome(b.cellClimate(cellX, cellZ), b.cellRand(cellX, cellZ))
+	b.candidates.Store(key, biome)
+	return biome
+}
+
+func (b *BiomeSelector) biomeForCell(cellX, cellZ int) *pkg.BiomeProperties {
+	key := [2]int{cellX, cellZ}
+	if biome, ok := b.cells.Load(key); ok {
+		return biome.(*pkg.BiomeProperties)
+	}
+
+	biome := b.candidate(cellX, cellZ)
+
+	// A hot cell next to a cold one (or the opposite) becomes temperate.
+	// Only the candidates of the neighbors are compared, and a demoted cell only gets a temperate
+	// biome, so two cells that touch can never end up hot and cold.
+	// Worley borders can happen between cells two steps apart, so that is the reach of the check.
+	if band := biomeBand(biome); band != 0 {
+	neighbors:
+		for dx := -2; dx <= 2; dx++ {
+			for dz := -2; dz <= 2; dz++ {
+				if biomeBand(b.candidate(cellX+dx, cellZ+dz)) != -band {
+					continue
+				}
+				climate := b.cellClimate(cellX, cellZ)
+				climate.Temperature = temperateTemperature
+				temperate := closestBiome(climate, b.cellRand(cellX, cellZ), func(biome *pkg.BiomeProperties) bool {
+					return biomeBand(biome) == 0
+				})
+				if temperate != nil { // nil when the data has no temperate biome
+					biome = temperate
+				}
+				break neighbors
+			}
+		}
+	}
+
+	b.cells.Store(key, biome)
+	return biome
+}
 
-	biomeKeys := []string{"Meadow", "Birchwood", "Savanna", "Desert"}
-	key := biomeKeys[r.Intn(len(biomeKeys))]
-	return BiomeTypes[key]
+// Returns the land biome whose climate ranges are the closest to the climate,
+// biomes that fit equally well are picked at random
+func matchBiome(climate Climate, r *rand.Rand) *pkg.BiomeProperties {
+	return closestBiome(climate, r, nil)
 }
 
-func globalHeight(gx, gz int, p *perlin.Perlin) float64 {
-	freq := 0.002
-	n := p.Noise2D(float64(gx)*freq, float64(gz)*freq) // [-1,1]
-	return (n + 1.0) / 2.0                             // normalizes to [0,1]
+// matchBiome among the land biomes that allow accepts (nil accepts all of them).
+// Returns nil when none is accepted.
+func closestBiome(climate Climate, r *rand.Rand, allow func(*pkg.BiomeProperties) bool) *pkg.BiomeProperties {
+	var candidates []*pkg.BiomeProperties
+	best := math.MaxFloat64
+
+	for _, biome := range Biomes.All() {
+		if biome.Sea != "" {
+			continue // placed by shapeSea
+		}
+		if allow != nil && !allow(biome) {
+			continue
+		}
+		d := rangeDistance(climate.Temperature, biome.Climate.Temperature) +
+			rangeDistance(climate.Humidity, biome.Climate.Humidity) +
+			rangeDistance(climate.Continentalness, biome.Climate.Continentalness) +
+			rangeDistance(climate.Altitude, biome.Climate.Altitude)
+
+		if d < best {
+			best = d
+			candidates = candidates[:0]
+		}
+		if d == best {
+			candidates = append(candidates, biome)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[r.Intn(len(candidates))]
 }
 
-func meadowModifier(gx, gz int, p2, p3 *perlin.Perlin) float64 {
-	n2 := p2.Noise2D(float64(gx)*0.09, float64(gz)*0.09)
-	n3 := p3.Noise2D(float64(gx)*0.01, float64(gz)*0.01)
+// Squared distance from a value to a [min, max] range (0 when inside)
+func rangeDistance(value float64, limits [2]float64) float64 {
+	if value < limits[0] {
+		return (limits[0] - value) * (limits[0] - value)
+	}
+	if value > limits[1] {
+		return (value - limits[1]) * (value - limits[1])
+	}
+	return 0
+}
 
-	// Narrower mountains
-	n2 = math.Pow(math.Abs(n2), 4)
+func globalHeight(gx, gz int, p noise.Source) float64 {
+	return noise.Normalize(p.Noise2D(float64(gx), float64(gz))) // [-1,1] → [0,1]
+}
 
-	// Combines both (can be done with sum, average, or another function)
-	return (n2*1.2 + n3*0.3) * float64(pkg.WorldHeight/2) // Normalizes the noise value to [0, worldHeight / 2]
+// Evaluates the height modifier of a biome, the sum of its noise layers
+func (g *Generator) biomeModifier(biome *pkg.BiomeProperties, gx, gz int) float64 {
+	total := 0.0
+	for _, layer := range biome.HeightLayers {
+		source := g.Primary
+		if layer.Source == "secondary" {
+			source = g.Secondary
+		}
+		n := source.Noise2D(float64(gx)*layer.Frequency, float64(gz)*layer.Frequency)
+		total += shapeNoise(layer, n)
+	}
+	return total * biome.HeightScale * float64(g.World.Height)
 }
 
-func desertModifier(gx, gz int, p2, p3 *perlin.Perlin) float64 {
-	n := p2.Noise2D(float64(gx)*0.003, float64(gz)*0.003)
-	base := n * 0.7 * float64(pkg.WorldHeight/3)
-	return base
+// Applies the shaping options of a layer to a noise value in [-1, 1]
+func shapeNoise(layer pkg.NoiseLayer, n float64) float64 {
+	if layer.Ridged {
+		n = 1 - math.Abs(n)
+	} else if layer.Abs {
+		n = math.Abs(n)
+	}
+
+	if layer.Normalize {
+		n = (n + 1) / 2.0
+	}
+
+	if layer.Power != 0 && layer.Power != 1 {
+		n = math.Copysign(math.Pow(math.Abs(n), layer.Power), n)
+	}
+
+	return n * layer.Amplitude
 }
 
 /*
@@ -161,20 +442,6 @@ func mauntainModifier(gx, gz int, p2, p3 *perlin.Perlin) float64 {
 }
 */
 
-func birchwoodModifier(gx, gz int, p2, p3 *perlin.Perlin) float64 {
-	n2 := p2.Noise2D(float64(gx)*0.007, float64(gz)*0.007)
-	n3 := p3.Noise2D(float64(gx)*0.01, float64(gz)*0.01)
-
-	return (n2*0.6 + n3*0.3) * float64(pkg.WorldHeight/3)
-}
-
-func savannaModifier(gx, gz int, p2, p3 *perlin.Perlin) float64 {
-	n2 := p2.Noise2D(float64(gx)*0.007, float64(gz)*0.007)
-	n3 := p3.Noise2D(float64(gx)*0.02, float64(gz)*0.02)
-
-	return (n2*0.4 + n3*0.3) * float64(pkg.WorldHeight/3)
-}
-
 /*
 func mountainModifier(gx, gz int, p2, p3 *perlin.Perlin) float64 {
 	// Defina um centro fixo ou derivado do Worley
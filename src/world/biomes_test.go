@@ -0,0 +1,126 @@
+package world
+
+import (
+	"math/rand"
+	"testing"
+	"testing/fstest"
+)
+
+// Replaces Biomes for the rest of the test
+func useBiomes(t *testing.T, data string) {
+	t.Helper()
+	registry, err := LoadBiomeRegistry(fstest.MapFS{"biomes.json": {Data: []byte(data)}}, "biomes.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := Biomes
+	Biomes = registry
+	t.Cleanup(func() { Biomes = previous })
+}
+
+func TestMatchBiome(t *testing.T) {
+	useBiomes(t, `{"biomes": [
+		{"name": "Cold", "surfaceBlock": "Grass", "undergroundBlock": "Dirt", "climate": {"temperature": [0, 0.3]}},
+		{"name": "Wet", "surfaceBlock": "Grass", "undergroundBlock": "Dirt", "climate": {"temperature": [0.3, 0.7], "humidity": [0.6, 1]}},
+		{"name": "Dry", "surfaceBlock": "Sand", "undergroundBlock": "Sand", "climate": {"temperature": [0.3, 0.7], "humidity": [0, 0.4]}},
+		{"name": "Hot", "surfaceBlock": "Sand", "undergroundBlock": "Sand", "climate": {"temperature": [0.8, 1], "humidity": [0, 0.2]}},
+		{"name": "Sea", "surfaceBlock": "Sand", "undergroundBlock": "Sand", "sea": "ocean"}
+	]}`)
+
+	tests := []struct {
+		name    string
+		climate Climate
+		want    []string // any of them
+	}{
+		{"inside one range", Climate{Temperature: 0.1, Humidity: 0.5}, []string{"Cold"}},
+		{"inside another", Climate{Temperature: 0.5, Humidity: 0.8}, []string{"Wet"}},
+		{"on a shared border", Climate{Temperature: 0.3, Humidity: 0.8}, []string{"Cold", "Wet"}},
+		{"between two ranges", Climate{Temperature: 0.5, Humidity: 0.5}, []string{"Wet", "Dry"}},
+		{"in no range, the closest", Climate{Temperature: 0.75, Humidity: 0.1}, []string{"Dry", "Hot"}},
+		{"in no range, closer to one", Climate{Temperature: 1, Humidity: 0.3}, []string{"Hot"}},
+	}
+
+	for _, test := range tests {
+		seen := make(map[string]bool)
+		for seed := range int64(50) {
+			biome := matchBiome(test.climate, rand.New(rand.NewSource(seed)))
+			seen[biome.Name] = true
+		}
+		for name := range seen {
+			found := false
+			for _, want := range test.want {
+				found = found || name == want
+			}
+			if !found {
+				t.Errorf("%s: got %s, want one of %v", test.name, name, test.want)
+			}
+		}
+		// Ties are broken at random, so each of them comes up
+		if len(seen) != len(test.want) {
+			t.Errorf("%s: got %v, want each of %v", test.name, seen, test.want)
+		}
+	}
+}
+
+func TestRangeDistance(t *testing.T) {
+	tests := []struct {
+		value  float64
+		limits [2]float64
+		want   float64
+	}{
+		{0.5, [2]float64{0.2, 0.8}, 0},
+		{0.2, [2]float64{0.2, 0.8}, 0},
+		{0.1, [2]float64{0.2, 0.8}, 0.01},
+		{1, [2]float64{0.2, 0.8}, 0.04},
+	}
+	for _, test := range tests {
+		if got := rangeDistance(test.value, test.limits); got < test.want-1e-9 || got > test.want+1e-9 {
+			t.Errorf("rangeDistance(%v, %v) = %v, want %v", test.value, test.limits, got, test.want)
+		}
+	}
+}
+
+func TestBiomeBandsComeFromTheData(t *testing.T) {
+	bands := map[string]int{"Tundra": -1, "Taiga": -1, "Meadow": 0, "Birchwood": 0, "Savanna": 1, "Desert": 1}
+	for name, want := range bands {
+		biome, ok := Biomes.Get(name)
+		if !ok {
+			t.Fatalf("no %s biome", name)
+		}
+		if got := biomeBand(biome); got != want {
+			t.Errorf("%s is in band %d, want %d", name, got, want)
+		}
+	}
+}
+
+func TestHotAndColdBiomesNeverTouch(t *testing.T) {
+	for _, seed := range []int64{42, 7} {
+		selector := NewGenerator(seed, DefaultSettings).BiomeSelector
+
+		// Cells that touch can be up to 2 cells apart (see biomeForCell)
+		demoted := 0
+		for x := -40; x < 40; x++ {
+			for z := -40; z < 40; z++ {
+				biome := selector.biomeForCell(x, z)
+				if biome != selector.candidate(x, z) {
+					demoted++
+				}
+				band := biomeBand(biome)
+				if band == 0 {
+					continue
+				}
+				for dx := -2; dx <= 2; dx++ {
+					for dz := -2; dz <= 2; dz++ {
+						if other := selector.biomeForCell(x+dx, z+dz); biomeBand(other) == -band {
+							t.Fatalf("seed %d: %s at cell %d %d touches %s at %d %d", seed, biome.Name, x, z, other.Name, x+dx, z+dz)
+						}
+					}
+				}
+			}
+		}
+		// Otherwise the climate never puts hot and cold cells close and the test proves nothing
+		if demoted == 0 {
+			t.Errorf("seed %d: no cell was made temperate", seed)
+		}
+	}
+}
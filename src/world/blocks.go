@@ -0,0 +1,163 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"go-engine/assets"
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// How a block is drawn
+type RenderLayer uint8
+
+const (
+	LayerNone        RenderLayer = iota // not drawn (air)
+	LayerOpaque                         // part of the chunk mesh
+	LayerModel                          // drawn with its own model (plants)
+	LayerTranslucent                    // blended back-to-front, liquids only show their surface
+	LayerSky                            // flat translucent quads (clouds), can be hidden in the menu
+)
+
+var renderLayerNames = map[string]RenderLayer{
+	"none":        LayerNone,
+	"opaque":      LayerOpaque,
+	"model":       LayerModel,
+	"translucent": LayerTranslucent,
+	"sky":         LayerSky,
+}
+
+// see https://github.com/adct-the-experimenter/Raylib_VoxelEngine/blob/main/blockfacehelper.c for inspiration
+type BlockProperties struct {
+	ID            pkg.BlockID
+	Name          string
+	Color         rl.Color
+	IsSolid       bool // collides and hides the faces of its neighbors
+	IsVisible     bool
+	IsTransparent bool // light and sight go through it
+	IsLiquid      bool
+	IsReplaceable bool  // generated features may overwrite it
+	LightLevel    uint8 // emitted light, 0 - 15
+	RenderLayer   RenderLayer
+	Hardness      float32
+}
+
+// Block definition as it is written in the data file
+type blockDefinition struct {
+	ID          pkg.BlockID `json:"id"`
+	Name        string      `json:"name"`
+	Color       [4]uint8    `json:"color"`
+	Layer       string      `json:"layer"`
+	Solid       bool        `json:"solid"`
+	Transparent bool        `json:"transparent"`
+	Liquid      bool        `json:"liquid"`
+	Replaceable bool        `json:"replaceable"`
+	Light       uint8       `json:"light"`
+	Hardness    float32     `json:"hardness"`
+}
+
+// Assigns stable numeric IDs to blocks. The IDs come from the data file, so they never
+// change between sessions and can be stored in saved chunks.
+type BlockRegistry struct {
+	blocks []BlockProperties // indexed by ID
+	ids    map[string]pkg.BlockID
+}
+
+// Every block of the game, loaded from assets/data/blocks.json
+var Blocks = mustLoadDefaultBlocks()
+
+func mustLoadDefaultBlocks() *BlockRegistry {
+	registry, err := LoadBlockRegistry(assets.Data, "data/blocks.json")
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+func LoadBlockRegistry(fsys fs.FS, path string) (*BlockRegistry, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Blocks []blockDefinition `json:"blocks"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	registry := &BlockRegistry{ids: make(map[string]pkg.BlockID)}
+
+	for _, def := range file.Blocks {
+		layer, ok := renderLayerNames[def.Layer]
+		if !ok {
+			return nil, fmt.Errorf("%s: block %q has unknown layer %q", path, def.Name, def.Layer)
+		}
+		if _, ok := registry.ids[def.Name]; ok {
+			return nil, fmt.Errorf("%s: block %q is defined twice", path, def.Name)
+		}
+
+		for int(def.ID) >= len(registry.blocks) {
+			registry.blocks = append(registry.blocks, BlockProperties{})
+		}
+		if registry.blocks[def.ID].Name != "" {
+			return nil, fmt.Errorf("%s: blocks %q and %q share the id %d", path, registry.blocks[def.ID].Name, def.Name, def.ID)
+		}
+
+		registry.blocks[def.ID] = BlockProperties{
+			ID:            def.ID,
+			Name:          def.Name,
+			Color:         rl.NewColor(def.Color[0], def.Color[1], def.Color[2], def.Color[3]),
+			IsSolid:       def.Solid,
+			IsVisible:     layer != LayerNone,
+			IsTransparent: def.Transparent,
+			IsLiquid:      def.Liquid,
+			IsReplaceable: def.Replaceable,
+			LightLevel:    def.Light,
+			RenderLayer:   layer,
+			Hardness:      def.Hardness,
+		}
+		registry.ids[def.Name] = def.ID
+	}
+
+	// Empty voxels (the zero value of pkg.VoxelData) are air
+	if len(registry.blocks) == 0 || registry.blocks[0].Name != "Air" {
+		return nil, fmt.Errorf("%s: id 0 must be reserved for Air", path)
+	}
+
+	// IDs that the file skips behave like air
+	for id, block := range registry.blocks {
+		if block.Name == "" {
+			registry.blocks[id] = registry.blocks[0]
+		}
+	}
+
+	return registry, nil
+}
+
+// Returns the properties of a block. Unknown IDs (and the ones the data file skips) behave like air.
+func (r *BlockRegistry) Get(id pkg.BlockID) BlockProperties {
+	if int(id) >= len(r.blocks) {
+		return r.blocks[0]
+	}
+	return r.blocks[id]
+}
+
+// Returns the ID of a block by its name, unknown names are air
+func (r *BlockRegistry) ID(name string) pkg.BlockID {
+	return r.ids[name]
+}
+
+func (r *BlockRegistry) Lookup(name string) (pkg.BlockID, bool) {
+	id, ok := r.ids[name]
+	return id, ok
+}
+
+// Shortcut for a plain voxel (no color or model) of the named block
+func voxelOf(name string) pkg.VoxelData {
+	return pkg.VoxelData{Type: Blocks.ID(name)}
+}
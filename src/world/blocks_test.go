@@ -0,0 +1,111 @@
+package world
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"go-engine/assets"
+	"go-engine/src/pkg"
+)
+
+// The default data files, with some of them replaced
+func dataFS(t *testing.T, files map[string]string) fstest.MapFS {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	err := fs.WalkDir(assets.Data, ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(assets.Data, path)
+		fsys[path] = &fstest.MapFile{Data: data}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range files {
+		fsys[path] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return fsys
+}
+
+func loadBlocks(t *testing.T, data string) (*BlockRegistry, error) {
+	t.Helper()
+	return LoadBlockRegistry(fstest.MapFS{"blocks.json": {Data: []byte(data)}}, "blocks.json")
+}
+
+func TestBlockRegistry(t *testing.T) {
+	registry, err := loadBlocks(t, `{"blocks": [
+		{"id": 0, "name": "Air", "layer": "none", "replaceable": true},
+		{"id": 1, "name": "Stone", "layer": "opaque", "solid": true, "hardness": 1.5},
+		{"id": 4, "name": "Water", "layer": "translucent", "liquid": true, "transparent": true}
+	]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stone := registry.Get(registry.ID("Stone"))
+	if stone.Name != "Stone" || !stone.IsSolid || !stone.IsVisible || stone.Hardness != 1.5 {
+		t.Errorf("stone loaded as %+v", stone)
+	}
+	if id, ok := registry.Lookup("Water"); !ok || id != 4 || registry.Get(id).RenderLayer != LayerTranslucent {
+		t.Errorf("water has id %d (%v)", id, ok)
+	}
+	if _, ok := registry.Lookup("Dirt"); ok || registry.ID("Dirt") != 0 {
+		t.Error("an unknown name was found")
+	}
+
+	// IDs skipped by the file and IDs past the end behave like air
+	air := registry.Get(0)
+	for _, id := range []uint16{2, 3, 5, 500} {
+		if block := registry.Get(pkg.BlockID(id)); block != air {
+			t.Errorf("id %d is %+v, not air", id, block)
+		}
+	}
+}
+
+func TestBlockRegistryErrors(t *testing.T) {
+	tests := map[string]string{
+		"no air":        `{"blocks": [{"id": 0, "name": "Stone", "layer": "opaque"}]}`,
+		"empty":         `{"blocks": []}`,
+		"unknown layer": `{"blocks": [{"id": 0, "name": "Air", "layer": "none"}, {"id": 1, "name": "Stone", "layer": "solid"}]}`,
+		"duplicate name": `{"blocks": [{"id": 0, "name": "Air", "layer": "none"},
+			{"id": 1, "name": "Stone", "layer": "opaque"}, {"id": 2, "name": "Stone", "layer": "opaque"}]}`,
+		"shared id": `{"blocks": [{"id": 0, "name": "Air", "layer": "none"},
+			{"id": 1, "name": "Stone", "layer": "opaque"}, {"id": 1, "name": "Dirt", "layer": "opaque"}]}`,
+		"bad json": `{"blocks": [`,
+	}
+	for name, data := range tests {
+		if _, err := loadBlocks(t, data); err == nil {
+			t.Errorf("%s: loaded without error", name)
+		}
+	}
+}
+
+func TestLoadDataIsAllOrNothing(t *testing.T) {
+	blocks, ores, trees, biomes, structures := Blocks, Ores, Trees, Biomes, Structures
+	defer func() { Blocks, Ores, Trees, Biomes, Structures = blocks, ores, trees, biomes, structures }()
+
+	// The blocks load, but the biomes don't
+	fsys := dataFS(t, map[string]string{"data/biomes.json": `{"biomes": [`})
+	if err := LoadData(fsys); err == nil {
+		t.Fatal("broken biomes loaded without error")
+	}
+	if Blocks != blocks || Ores != ores || Trees != trees || Biomes != biomes || Structures != structures {
+		t.Error("some registries were replaced although the biomes failed to load")
+	}
+
+	if err := LoadData(dataFS(t, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if Blocks == blocks || Structures == structures {
+		t.Error("the registries weren't replaced")
+	}
+	if Blocks.ID("Stone") != blocks.ID("Stone") || len(Biomes.All()) != len(biomes.All()) {
+		t.Error("the default data loaded differently")
+	}
+	if Blocks.Get(0).Name != "Air" {
+		t.Error("id 0 isn't air")
+	}
+}
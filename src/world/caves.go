@@ -0,0 +1,93 @@
+package world
+
+import (
+	"go-engine/src/noise"
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	cheeseThreshold = 0.55 // noise value above which cheese caves are open
+	spaghettiWidth  = 0.06 // how close to zero both spaghetti noises must be
+	noodleWidth     = 0.035
+
+	// Cheese caves stay this far below the surface, so they don't open giant holes in the ground
+	cheeseCover = 8
+	// No cave reaches the sea floor (or riverbed) closer than this, so the water doesn't drain into them
+	seaFloorCover = 4
+)
+
+// Decides where caves are. Every decision only depends on the seed and the world position,
+// so caves continue across chunk borders no matter which chunk is generated first.
+type CaveCarver struct {
+	Cheese    noise.Source    // large caverns where the noise is high
+	Spaghetti [2]noise.Source // tunnels where both noises are close to zero (the intersection of two surfaces)
+	Noodle    [2]noise.Source // same as spaghetti, thinner and more twisted
+}
+
+func NewCaveCarver(seed int64) *CaveCarver {
+	carver := &CaveCarver{
+		Cheese: noise.NewFBM(noise.NewPerlin(noise.DeriveSeed(seed, 0)), noise.DefaultOctaves(2, 1.0/48)),
+	}
+	for i := range 2 {
+		carver.Spaghetti[i] = noise.NewFBM(noise.NewPerlin(noise.DeriveSeed(seed, int64(1+i))), noise.DefaultOctaves(1, 1.0/64))
+		carver.Noodle[i] = noise.NewFBM(noise.NewPerlin(noise.DeriveSeed(seed, int64(3+i))), noise.DefaultOctaves(1, 1.0/24))
+	}
+	return carver
+}
+
+// Tells if the voxel at a world position is inside a cave. surface is the terrain height of the column.
+func (c *CaveCarver) IsCave(gx, y, gz, surface int, settings pkg.CaveSettings) bool {
+	x, fy, z := float64(gx), float64(y), float64(gz)
+
+	// Caverns are wider than they are tall
+	if settings.Cheese > 0 && y < surface-cheeseCover {
+		if c.Cheese.Noise3D(x, fy*2, z) > cheeseThreshold/settings.Cheese {
+			return true
+		}
+	}
+
+	if settings.Spaghetti > 0 && tunnel(c.Spaghetti, x, fy, z, spaghettiWidth*settings.Spaghetti) {
+		return true
+	}
+
+	if settings.Noodle > 0 && tunnel(c.Noodle, x, fy, z, noodleWidth*settings.Noodle) {
+		return true
+	}
+	return false
+}
+
+func tunnel(sources [2]noise.Source, x, y, z, width float64) bool {
+	a := sources[0].Noise3D(x, y, z)
+	if a < -width || a > width {
+		return false // skips the second noise most of the time
+	}
+	b := sources[1].Noise3D(x, y, z)
+	return b > -width && b < width
+}
+
+// Carves the caves of a terrain column. Runs before the water is added,
+// underwater tells if the column will be under the sea or a river.
+func (g *Generator) carveCaves(column *pkg.Column, position rl.Vector3, x, z int, underwater bool) {
+	gx := int(position.X) + x
+	gz := int(position.Z) + z
+
+	surface := column.HeightMap[x][z]
+	settings := column.BiomeMap[x][z].Caves
+
+	top := min(surface, column.MaxY()-1)
+	if underwater {
+		top = surface - seaFloorCover
+	}
+
+	// The two lowest layers of the world are kept as a floor
+	for y := column.MinY() + 2; y <= top; y++ {
+		if !Blocks.Get(column.Get(x, y, z).Type).IsSolid {
+			continue
+		}
+		if g.Caves.IsCave(gx, y, gz, surface, settings) {
+			column.Set(x, y, z, voxelOf("Air"))
+		}
+	}
+}
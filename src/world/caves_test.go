@@ -0,0 +1,72 @@
+package world
+
+import (
+	"testing"
+
+	"go-engine/src/noise"
+	"go-engine/src/pkg"
+)
+
+func TestCavesAreAPureFunctionOfPosition(t *testing.T) {
+	gen := NewGenerator(11, DefaultSettings)
+	carver := NewCaveCarver(noise.DeriveSeed(11, 6))
+
+	// Neighbors generated in different orders and caches
+	coords := []pkg.Coords{{X: 0, Z: 0}, {X: 1, Z: 0}, {X: 0, Z: 1}}
+	caves := 0
+	for _, coord := range coords {
+		column := gen.Generate(coord)
+		origin := ChunkOrigin(coord)
+
+		for x := range pkg.ChunkSize {
+			for z := range pkg.ChunkSize {
+				gx, gz := int(origin.X)+x, int(origin.Z)+z
+				surface := column.HeightMap[x][z]
+				settings := column.BiomeMap[x][z].Caves
+
+				for y := column.MinY() + 2; y < surface-seaFloorCover; y++ {
+					if !carver.IsCave(gx, y, gz, surface, settings) {
+						continue
+					}
+					caves++
+					if Blocks.Get(column.Get(x, y, z).Type).IsSolid {
+						t.Fatalf("column %v: (%d, %d, %d) is a cave but is solid", coord, gx, y, gz)
+					}
+				}
+			}
+		}
+	}
+
+	if caves == 0 {
+		t.Error("no caves were carved")
+	}
+}
+
+func TestCaveSettingsControlTheAmount(t *testing.T) {
+	carver := NewCaveCarver(5)
+
+	count := func(settings pkg.CaveSettings) int {
+		n := 0
+		for x := 0; x < 64; x++ {
+			for y := -32; y < 32; y++ {
+				for z := 0; z < 64; z++ {
+					if carver.IsCave(x, y, z, 100, settings) {
+						n++
+					}
+				}
+			}
+		}
+		return n
+	}
+
+	none := count(pkg.CaveSettings{})
+	normal := count(pkg.CaveSettings{Cheese: 1, Spaghetti: 1, Noodle: 1})
+	more := count(pkg.CaveSettings{Cheese: 2, Spaghetti: 2, Noodle: 2})
+
+	if none != 0 {
+		t.Errorf("caves were carved with every kind disabled (%d voxels)", none)
+	}
+	if normal == 0 || more <= normal {
+		t.Errorf("higher settings should carve more: %d voxels with 1, %d with 2", normal, more)
+	}
+}
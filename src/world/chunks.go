@@ -1,186 +1,383 @@
 package world
 
 import (
+	"fmt"
 	"math"
-	"runtime"
+	"sort"
 	"sync"
 
 	"go-engine/src/pkg"
 
-	"github.com/aquilax/go-perlin"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
-const MaxChunksPerFrame = 2
+// Stages (decoration, finishing) run on the main thread, at most this many per frame
+const MaxStagesPerFrame = 4
 
-type PendingWrite struct {
-	Pos   [3]int
-	Voxel pkg.VoxelData
+// Columns are loaded this much further than they are shown: a column is decorated once its
+// neighbors have their terrain, and shown once its neighbors are decorated. The areas are
+// circles, so the columns two rings away on a diagonal are 2√2 further than the shown ones.
+const generationMargin = 3
+
+// Loaded columns are only unloaded this much further than they are loaded, so walking back and
+// forth along the edge doesn't unload and load the same columns again
+const unloadMargin = 2
+
+// Distances around the player, in columns
+type Radii struct {
+	Render     int // chunks of finished columns are drawn
+	Simulation int // columns are loaded and go through the stages
+	Unload     int // loaded columns further than this are unloaded
+}
+
+// Radii for a view distance (pkg.ChunkDistance)
+func RadiiFor(viewDistance int) Radii {
+	return Radii{
+		Render:     viewDistance,
+		Simulation: viewDistance + generationMargin,
+		Unload:     viewDistance + generationMargin + unloadMargin,
+	}
+}
+
+// Tells if a column is inside a circle of a radius (in columns) around center.
+// Columns whose center is less than half a column past the radius are inside.
+func withinRadius(coord, center pkg.Coords, radius int) bool {
+	dx, dz := coord.X-center.X, coord.Z-center.Z
+	return dx*dx+dz*dz <= radius*radius+radius
 }
 
+// Tells if a chunk is close enough to the player to be drawn
+func InRenderDistance(coord pkg.Coords, playerPosition rl.Vector3) bool {
+	player := ToChunkCoord(playerPosition)
+	return withinRadius(coord, player, RadiiFor(pkg.ChunkDistance).Render)
+}
+
+// Loaded columns and the chunks that are drawn. Concurrency model:
+//
+//   - Workers (see Streamer) build new columns on their own and never touch the cache. A column is
+//     handed to the main thread through a channel and only registered there, complete.
+//   - Once registered, columns and chunks are only changed by the main thread (the one that calls
+//     ManageChunks and renders). What other goroutines read, the maps and the voxels and stages of
+//     the columns, is only changed with CacheMutex locked for writing.
+//   - So the main thread can read them without the lock, while any other goroutine must hold
+//     CacheMutex for reading (getVoxelGlobal does).
+//   - Fields no other goroutine reads are written by the main thread without the lock: IsDirty,
+//     and NeedsRemesh and Model of the chunks (render).
+//   - Unloaded columns that must be saved are handed to the writer (columnWriter), which owns them
+//     and their chunks from then on. Workers only read them, to load a copy.
+//   - State is written without the lock by the owner of the chunk: a worker while it builds the
+//     column, then the main thread, and the writer goroutine (under its own mutex) once the column
+//     is unloaded. Nothing else reads it, the events go through the mutex of Events.
+//   - Chunks are only added to Active when their column is final, so nothing half built is drawn.
+//   - Every chunk has a lifecycle state (pkg.ChunkState), changed by its owner through Transition.
 type ChunkCache struct {
-	Active        map[pkg.Coords]*pkg.Chunk      // chunks that are loaded, meshed, and ready to render.
-	PlantsCache   map[pkg.Coords][]pkg.PlantData // persistent plants by chunk
-	TreesCache    map[pkg.Coords][]pkg.TreeData
-	PendingVoxels map[pkg.Coords][]PendingWrite // queue of voxel modifications that haven’t yet been applied to the chunk
-	CacheMutex    sync.RWMutex                  // Synchronization primitive to protect concurrent access to the cache maps. Multiple goroutines may read chunk data in parallel, but writes (adding/removing chunks, applying voxel changes) must be exclusive
+	Columns    map[pkg.Coords]*pkg.Column // columns that are loaded (at any stage), by column coordinate (Y is always 0)
+	Active     map[pkg.Coords]*pkg.Chunk  // non-empty chunks of the finished columns, ready to be meshed and rendered
+	Store      *RegionStore               // where edited columns are saved when they unload (nil disables persistence)
+	writer     *columnWriter              // saves the unloaded columns, started by the first CleanUp that has one
+	CacheMutex sync.RWMutex               // held for writing by every change to the maps or to the voxels of loaded columns
+	Events     Lifecycle                  // transitions of the chunks, delivered once per frame by ManageChunks
 }
 
 func NewChunkCache() *ChunkCache {
 	// Creates a hash map to store voxel data
 	return &ChunkCache{
-		Active:        make(map[pkg.Coords]*pkg.Chunk),
-		PlantsCache:   make(map[pkg.Coords][]pkg.PlantData),
-		TreesCache:    make(map[pkg.Coords][]pkg.TreeData),
-		PendingVoxels: make(map[pkg.Coords][]PendingWrite),
+		Columns: make(map[pkg.Coords]*pkg.Column),
+		Active:  make(map[pkg.Coords]*pkg.Chunk),
 	}
 }
 
 func ToChunkCoord(pos rl.Vector3) pkg.Coords {
 	return pkg.Coords{
 		X: int(math.Floor(float64(pos.X) / float64(pkg.ChunkSize))),
-		Y: 0, //	Fixed Height
+		Y: int(math.Floor(float64(pos.Y) / float64(pkg.ChunkSize))),
 		Z: int(math.Floor(float64(pos.Z) / float64(pkg.ChunkSize))),
 	}
 }
 
-func (cc *ChunkCache) GetChunk(worley *WorleyNoise, biomeSel *BiomeSelector, position rl.Vector3, p1, p2, p3 *perlin.Perlin) *pkg.Chunk {
-	coord := ToChunkCoord(position)
+// Coordinate of the column a chunk belongs to
+func columnCoord(coord pkg.Coords) pkg.Coords {
+	return pkg.Coords{X: coord.X, Z: coord.Z}
+}
+
+// Converts a chunk coordinate to the world position of its first voxel
+func ChunkOrigin(coord pkg.Coords) rl.Vector3 {
+	return rl.NewVector3(float32(coord.X*pkg.ChunkSize), float32(coord.Y*pkg.ChunkSize), float32(coord.Z*pkg.ChunkSize))
+}
 
+// Returns a loaded column, or loads it from disk or generates its terrain right away.
+// Columns that are not finished yet go through the other stages in ManageChunks.
+func (cc *ChunkCache) GetColumn(gen *Generator, coord pkg.Coords) *pkg.Column {
 	cc.CacheMutex.RLock()
-	_, exists := cc.Active[coord]
-	oldPlants, hasPlants := cc.PlantsCache[coord]
-	oldTrees, hasTrees := cc.TreesCache[coord]
+	column, exists := cc.Columns[coord]
 	cc.CacheMutex.RUnlock()
-
-	var newChunk *pkg.Chunk
-
 	if exists {
-		newChunk = GenerateChunk(worley, biomeSel, position, p1, p2, p3, cc, oldPlants, true, oldTrees, true)
-	} else {
-		// First time the chunk is generated
-		// If there are saved plants, reuse them; if not, create new ones
-		if (hasPlants && len(oldPlants) > 0) || (hasTrees && len(oldTrees) > 0) {
-			newChunk = GenerateChunk(worley, biomeSel, position, p1, p2, p3, cc, oldPlants, true, oldTrees, true)
-		} else {
-			newChunk = GenerateChunk(worley, biomeSel, position, p1, p2, p3, cc, nil, false, nil, false)
+		return column
+	}
+	return cc.add(cc.loadColumn(gen, coord))
+}
+
+// Reads a column from disk, or generates its terrain. It doesn't touch the cache maps,
+// so the workers of the Streamer can run it.
+func (cc *ChunkCache) loadColumn(gen *Generator, coord pkg.Coords) *pkg.Column {
+	var column *pkg.Column
+
+	// Columns that were saved before are read from disk instead of being generated,
+	// or copied from the writer when it didn't get to them yet
+	if cc.Store != nil {
+		cc.CacheMutex.RLock()
+		writer := cc.writer
+		cc.CacheMutex.RUnlock()
+		if writer != nil {
+			column = writer.Unsaved(coord, gen.World)
 		}
 	}
+	if cc.Store != nil && column == nil {
+		stored, err := cc.Store.Load(coord, gen.World)
+		if err != nil {
+			fmt.Printf("Failed to load column %v: %v\n", coord, err)
+		}
+		column = stored
+	}
+	if column == nil {
+		column = gen.generateTerrain(coord)
+	}
+
+	cc.adopt(column)
+	return column
+}
 
-	newChunk.IsOutdated = true // reset flag after reconstruction --> ensures that the mesh is rebuilt and the plant voxels are reapplied
+// Registers a loaded column. If the coordinate already has one, that one is kept and returned.
+func (cc *ChunkCache) add(column *pkg.Column) *pkg.Column {
+	coord := pkg.Coords{X: column.X, Z: column.Z}
 
-	// Update caches
 	cc.CacheMutex.Lock()
-	cc.Active[coord] = newChunk
-
-	// applies pending issues after the core terrain generation so tree voxels aren’t overwritten.
-	if writes, ok := cc.PendingVoxels[coord]; ok {
-		for _, w := range writes {
-			if w.Pos[0] >= 0 && w.Pos[0] < pkg.ChunkSize &&
-				w.Pos[1] >= 0 && w.Pos[1] < pkg.WorldHeight &&
-				w.Pos[2] >= 0 && w.Pos[2] < pkg.ChunkSize {
-				newChunk.Voxels[w.Pos[0]][w.Pos[1]][w.Pos[2]] = w.Voxel
-			}
+	defer cc.CacheMutex.Unlock()
+
+	if loaded, ok := cc.Columns[coord]; ok {
+		cc.discard(chunksOf(column)...)
+		return loaded
+	}
+	cc.Columns[coord] = column
+	if column.Stage == pkg.StageFinal {
+		cc.activate(column)
+	}
+	return column
+}
+
+// Publishes the chunks of a finished column, so they are meshed and rendered
+func (cc *ChunkCache) activate(column *pkg.Column) {
+	for _, chunk := range column.Sections {
+		if chunk != nil {
+			chunk.NeedsRemesh = true
+			cc.Active[chunk.Coord] = chunk
 		}
-		newChunk.IsOutdated = true
-		delete(cc.PendingVoxels, coord)
 	}
+}
 
-	if len(newChunk.Plants) > 0 {
-		// Always save when generating/rebuilding
-		cc.PlantsCache[coord] = newChunk.Plants
-	} else if !hasPlants {
-		// Ensures key exists even if empty to avoid future nil checks
-		cc.PlantsCache[coord] = nil
+// Tells if the 8 columns around coord are loaded and reached a stage
+func (cc *ChunkCache) neighborsAt(coord pkg.Coords, stage pkg.Stage) bool {
+	for dx := -1; dx <= 1; dx++ {
+		for dz := -1; dz <= 1; dz++ {
+			neighbor, ok := cc.Columns[pkg.Coords{X: coord.X + dx, Z: coord.Z + dz}]
+			if !ok || neighbor.Stage < stage {
+				return false
+			}
+		}
 	}
+	return true
+}
+
+// Moves a loaded column to its next stage when its neighbors are ready. Returns true if it moved.
+func (cc *ChunkCache) advance(gen *Generator, coord pkg.Coords) bool {
+	cc.CacheMutex.RLock()
+	column, ok := cc.Columns[coord]
+	ready := ok && column.Stage < pkg.StageFinal && cc.neighborsAt(coord, column.Stage)
+	cc.CacheMutex.RUnlock()
 
-	if len(newChunk.Trees) > 0 {
-		cc.TreesCache[coord] = newChunk.Trees
-	} else if !hasTrees {
-		cc.TreesCache[coord] = nil
+	if !ready {
+		return false
 	}
 
-	cc.CacheMutex.Unlock()
+	cc.CacheMutex.Lock()
+	defer cc.CacheMutex.Unlock()
+
+	switch column.Stage {
+	case pkg.StageTerrain:
+		gen.decorate(column, cc)
+		for _, chunk := range chunksOf(column) {
+			if chunk.State == pkg.ChunkGenerated {
+				cc.Transition(chunk, pkg.ChunkDecorated)
+			}
+		}
+		// Trees may have grown into new chunks of the neighbors
+		for dx := -1; dx <= 1; dx++ {
+			for dz := -1; dz <= 1; dz++ {
+				cc.adopt(cc.Columns[pkg.Coords{X: coord.X + dx, Z: coord.Z + dz}])
+			}
+		}
+
+	case pkg.StageDecorated:
+		chunks := chunksOf(column)
+		finalize(column)
+		// Chunks left with nothing but air are gone
+		for _, chunk := range chunks {
+			if column.Section(chunk.Coord.Y) != chunk {
+				cc.discard(chunk)
+			}
+		}
+		cc.activate(column)
+	}
+	return true
+}
 
-	return newChunk
+// Chunks of a column that exist
+func chunksOf(column *pkg.Column) []*pkg.Chunk {
+	var chunks []*pkg.Chunk
+	for _, chunk := range column.Sections {
+		if chunk != nil {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
 }
 
+// Unloads the columns out of the unload radius. The ones the player edited are handed to the
+// writer, which saves them in the background; the others are generated again from the seed.
 func (cc *ChunkCache) CleanUp(playerPosition rl.Vector3) {
 	cc.CacheMutex.Lock()
 	defer cc.CacheMutex.Unlock()
 
-	playerCoord := ToChunkCoord(playerPosition)
-	chDist := int(pkg.ChunkDistance)
+	playerCoord := columnCoord(ToChunkCoord(playerPosition))
+	radius := RadiiFor(pkg.ChunkDistance).Unload
 
-	for coord := range cc.Active {
-		if Abs(coord.X-playerCoord.X) > chDist ||
-			Abs(coord.Z-playerCoord.Z) > chDist {
-			delete(cc.Active, coord)
-			// DO NOT delete cc.PlantsCache[coord] — plants remain stored
+	for coord, column := range cc.Columns {
+		if !withinRadius(coord, playerCoord, radius) {
+			delete(cc.Columns, coord)
+			for _, chunk := range chunksOf(column) {
+				delete(cc.Active, chunk.Coord)
+				cc.Transition(chunk, pkg.ChunkUnloading)
+			}
+			if column.IsDirty && cc.Store != nil {
+				// Queued while the lock is held, so a worker that loads it again finds it
+				if cc.writer == nil {
+					cc.writer = newColumnWriter(cc)
+				}
+				cc.writer.Queue(coord, column)
+				continue
+			}
+			cc.discard(chunksOf(column)...)
 		}
 	}
 }
 
-func ManageChunks(worley *WorleyNoise, biomeSel *BiomeSelector, playerPosition rl.Vector3, chunkCache *ChunkCache, p1, p2, p3 *perlin.Perlin) {
-	playerCoord := ToChunkCoord(playerPosition)
+// Waits for the columns that unloaded to be written, then writes every loaded column that
+// changed since it was last saved (used when the game closes)
+func (cc *ChunkCache) SaveAll() {
+	cc.CacheMutex.Lock()
+	writer := cc.writer
+	cc.writer = nil
+	cc.CacheMutex.Unlock()
+	if writer != nil {
+		writer.Close()
+	}
 
-	chunkRequests := make(chan rl.Vector3, 100)
-	done := make(chan struct{})
+	dirty := make(map[pkg.Coords]*pkg.Column)
 
-	// Worker pool
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go func() {
-			for cp := range chunkRequests {
-				chunkCache.GetChunk(worley, biomeSel, cp, p1, p2, p3)
-			}
-			done <- struct{}{}
-		}()
+	cc.CacheMutex.RLock()
+	for coord, column := range cc.Columns {
+		if column.IsDirty {
+			dirty[coord] = column
+		}
 	}
+	cc.CacheMutex.RUnlock()
 
-	// Counter to limit how many chunks are enqueued
-	chunksQueued := 0
+	cc.save(dirty)
+}
 
-	var candidates []pkg.Coords
+func (cc *ChunkCache) save(columns map[pkg.Coords]*pkg.Column) {
+	if cc.Store == nil {
+		return
+	}
+
+	for coord, column := range columns {
+		if err := cc.Store.Save(coord, column); err != nil {
+			fmt.Printf("Failed to save column %v: %v\n", coord, err)
+			continue
+		}
+		column.IsDirty = false
+	}
+}
+
+// Streams the columns around the player, called once per frame. It never waits for the workers:
+// it picks up the columns they finished, asks for the missing ones (the closest and the ones in
+// front of the camera first) and runs a few stages on the columns whose neighbors are ready.
+// Columns are loaded in a circle (see RadiiFor) and only unloaded once they are out of a larger one.
+func ManageChunks(streamer *Streamer, playerPosition, forward rl.Vector3) {
+	chunkCache := streamer.cache
+	playerCoord := columnCoord(ToChunkCoord(playerPosition))
+
+	// Columns around the visible ones are loaded too, so the visible ones can finish their stages
+	radii := RadiiFor(pkg.ChunkDistance)
+	loadDistance := radii.Simulation
+
+	// Columns that finished while the player moved away are dropped
+	for _, column := range streamer.Completed() {
+		if coord := (pkg.Coords{X: column.X, Z: column.Z}); withinRadius(coord, playerCoord, radii.Unload) {
+			chunkCache.add(column)
+		} else {
+			chunkCache.discard(chunksOf(column)...)
+		}
+	}
 
-	// Send the chunk positions to be loaded
-	for x := playerCoord.X - pkg.ChunkDistance; x <= playerCoord.X+pkg.ChunkDistance; x++ {
-		for z := playerCoord.Z - pkg.ChunkDistance; z <= playerCoord.Z+pkg.ChunkDistance; z++ {
-			candidates = append(candidates, pkg.Coords{X: x, Y: 0, Z: z})
+	priorities := make(map[pkg.Coords]float64)
+	var candidates []pkg.Coords
+	for x := playerCoord.X - loadDistance; x <= playerCoord.X+loadDistance; x++ {
+		for z := playerCoord.Z - loadDistance; z <= playerCoord.Z+loadDistance; z++ {
+			coord := pkg.Coords{X: x, Z: z}
+			if !withinRadius(coord, playerCoord, loadDistance) {
+				continue // corners that are never shown
+			}
+			priorities[coord] = viewPriority(coord, playerCoord, forward)
+			candidates = append(candidates, coord)
 		}
 	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return priorities[candidates[i]] < priorities[candidates[j]]
+	})
 
 	// Only one verification with lock per frame
+	missing := make(map[pkg.Coords]float64)
 	chunkCache.CacheMutex.RLock()
 	for _, coord := range candidates {
-		chunk, exists := chunkCache.Active[coord]
-		if !exists || (chunk != nil && chunk.IsOutdated) {
-			chunkPos := rl.NewVector3(float32(coord.X*pkg.ChunkSize), 0, float32(coord.Z*pkg.ChunkSize))
-
-			chunkRequests <- chunkPos
-
-			chunksQueued++
-
-			if chunksQueued >= MaxChunksPerFrame {
-				break // does not block the loop, only exits
-			}
+		if _, exists := chunkCache.Columns[coord]; !exists {
+			missing[coord] = priorities[coord]
 		}
 	}
 	chunkCache.CacheMutex.RUnlock()
-	close(chunkRequests)
+	streamer.Request(missing)
 
-	// Wait for all workers to finish
-	for i := 0; i < runtime.NumCPU(); i++ {
-		<-done
+	// Decorates and finishes the closest columns whose neighbors are ready.
+	// The outer ring only has its terrain, it is there for the neighbors.
+	// Stages run in the same order as the requests, in front of the camera first.
+	stages := 0
+	for _, coord := range candidates {
+		if stages >= MaxStagesPerFrame {
+			break
+		}
+		if withinRadius(coord, playerCoord, loadDistance-1) && chunkCache.advance(streamer.gen, coord) {
+			stages++
+		}
 	}
 
 	// Updates neighbors
 	chunkCache.CacheMutex.Lock()
-	// Ensures that each chunk on the chunkCache.chunks map has up-to-date references to its neighboring chunks on X and Z directions
+	// Ensures that each chunk on the chunkCache.Active map has up-to-date references to its neighboring chunks on every direction
 	for coord, chunk := range chunkCache.Active {
-		for i, direction := range pkg.HorizontalDirections {
+		for i, direction := range pkg.FaceDirections {
 			neighborCoord := pkg.Coords{
 				X: coord.X + int(direction.X),
-				Y: 0,
+				Y: coord.Y + int(direction.Y),
 				Z: coord.Z + int(direction.Z),
 			}
 			if neighbor, exists := chunkCache.Active[neighborCoord]; exists {
@@ -188,14 +385,14 @@ func ManageChunks(worley *WorleyNoise, biomeSel *BiomeSelector, playerPosition r
 					// Update reference
 					chunk.Neighbors[i] = neighbor
 					// Mark both as outdated to rebuild the mesh (exposed/hidden faces are recalculated, fixing the 'holes' in the terrain)
-					chunk.IsOutdated = true
-					neighbor.IsOutdated = true
+					chunk.NeedsRemesh = true
+					neighbor.NeedsRemesh = true
 				}
 			} else {
 				if chunk.Neighbors[i] != nil {
 					// Neighbor was removed → mark chunk as outdated
 					chunk.Neighbors[i] = nil
-					chunk.IsOutdated = true
+					chunk.NeedsRemesh = true
 				}
 			}
 		}
@@ -204,42 +401,91 @@ func ManageChunks(worley *WorleyNoise, biomeSel *BiomeSelector, playerPosition r
 
 	// Remove chunks outside the range
 	chunkCache.CleanUp(playerPosition)
-}
 
-func setVoxelGlobal(chunkCache *ChunkCache, globalPos rl.Vector3, voxel pkg.VoxelData) {
-	coord := ToChunkCoord(globalPos)
+	chunkCache.Events.Dispatch()
+}
 
-	// Protect map reading
-	chunkCache.CacheMutex.RLock()
-	chunk := chunkCache.Active[coord]
-	chunkCache.CacheMutex.RUnlock()
+// Column and local position of a voxel, nil when the column isn't loaded. The caller holds the lock.
+func (cc *ChunkCache) locate(globalPos rl.Vector3) (*pkg.Column, int, int, int) {
+	coord := columnCoord(ToChunkCoord(globalPos))
+	column := cc.Columns[coord]
 
 	// math.Floor prevents inconsistent rounding that throws blocks into the wrong chunk
 	localX := int(math.Floor(float64(globalPos.X))) - coord.X*pkg.ChunkSize
-	localY := int(math.Floor(float64(globalPos.Y)))
+	y := int(math.Floor(float64(globalPos.Y)))
 	localZ := int(math.Floor(float64(globalPos.Z))) - coord.Z*pkg.ChunkSize
 
-	if localX < 0 || localX >= pkg.ChunkSize ||
-		localY < 0 || localY >= pkg.WorldHeight ||
-		localZ < 0 || localZ >= pkg.ChunkSize {
-		return
+	return column, localX, y, localZ
+}
+
+// Voxel at a world position, air when its column isn't loaded
+func getVoxelGlobal(chunkCache *ChunkCache, globalPos rl.Vector3) pkg.VoxelData {
+	chunkCache.CacheMutex.RLock()
+	defer chunkCache.CacheMutex.RUnlock()
+	return chunkCache.voxel(globalPos)
+}
+
+// Writes a voxel at a world position for the player, the column is saved when it unloads.
+// Only the main thread may call it (see ChunkCache).
+func setVoxelGlobal(chunkCache *ChunkCache, globalPos rl.Vector3, voxel pkg.VoxelData) {
+	chunkCache.CacheMutex.Lock()
+	defer chunkCache.CacheMutex.Unlock()
+	if column := chunkCache.setVoxel(globalPos, voxel); column != nil {
+		column.IsDirty = true
 	}
+}
 
-	if chunk == nil {
-		chunkCache.CacheMutex.Lock()
-		chunkCache.PendingVoxels[coord] = append(chunkCache.PendingVoxels[coord], PendingWrite{
-			Pos:   [3]int{localX, localY, localZ},
-			Voxel: voxel,
-		})
-		chunkCache.CacheMutex.Unlock()
-		return
+// getVoxelGlobal for callers that already hold the lock
+func (cc *ChunkCache) voxel(globalPos rl.Vector3) pkg.VoxelData {
+	column, x, y, z := cc.locate(globalPos)
+	if column == nil {
+		return pkg.VoxelData{}
+	}
+	return column.Get(x, y, z)
+}
+
+// setVoxelGlobal for callers that already hold the write lock. Writes into columns that aren't
+// loaded are lost, so features must only reach the neighbors that the stages wait for.
+// Returns the column that changed, nil if none did.
+func (cc *ChunkCache) setVoxel(globalPos rl.Vector3, voxel pkg.VoxelData) *pkg.Column {
+	column, localX, y, localZ := cc.locate(globalPos)
+	if column == nil || !column.Set(localX, y, localZ, voxel) {
+		return nil
 	}
+	cc.adopt(column)
 
-	// if multiple goroutines write to the same chunk, consider a mutex per chunk
-	chunkCache.CacheMutex.Lock()
-	chunk.Voxels[localX][localY][localZ] = voxel
-	chunk.IsOutdated = true
-	chunkCache.CacheMutex.Unlock()
+	chunk := column.Section(floorDiv(y, pkg.ChunkSize))
+	if chunk != nil && column.Stage == pkg.StageFinal {
+		cc.Active[chunk.Coord] = chunk // the write may have created the chunk
+		cc.remesh(chunk.Coord, localX, y-chunk.Coord.Y*pkg.ChunkSize, localZ)
+	}
+	return column
+}
+
+// Marks the chunk of a changed voxel for remeshing, and the neighbors it touches,
+// whose faces against it may have appeared or disappeared
+func (cc *ChunkCache) remesh(coord pkg.Coords, x, y, z int) {
+	if chunk, ok := cc.Active[coord]; ok {
+		chunk.NeedsRemesh = true
+	}
+
+	local := [3]int{x, y, z}
+	for _, direction := range pkg.FaceDirections {
+		d := [3]int{int(direction.X), int(direction.Y), int(direction.Z)}
+		border := false
+		for axis := range 3 {
+			if (d[axis] == 1 && local[axis] == pkg.ChunkSize-1) || (d[axis] == -1 && local[axis] == 0) {
+				border = true
+			}
+		}
+		if !border {
+			continue
+		}
+		neighbor := pkg.Coords{X: coord.X + d[0], Y: coord.Y + d[1], Z: coord.Z + d[2]}
+		if chunk, ok := cc.Active[neighbor]; ok {
+			chunk.NeedsRemesh = true
+		}
+	}
 }
 
 // Function to calculate the absolute value
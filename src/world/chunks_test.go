@@ -0,0 +1,418 @@
+package world
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Coordinates of a square of columns around center, in grid order
+func square(center pkg.Coords, radius int) []pkg.Coords {
+	var coords []pkg.Coords
+	for x := center.X - radius; x <= center.X+radius; x++ {
+		for z := center.Z - radius; z <= center.Z+radius; z++ {
+			coords = append(coords, pkg.Coords{X: x, Z: z})
+		}
+	}
+	return coords
+}
+
+// Coordinates of the columns within a radius of center
+func circle(center pkg.Coords, radius int) []pkg.Coords {
+	var coords []pkg.Coords
+	for _, coord := range square(center, radius) {
+		if withinRadius(coord, center, radius) {
+			coords = append(coords, coord)
+		}
+	}
+	return coords
+}
+
+func TestStagesWaitForTheNeighbors(t *testing.T) {
+	gen := NewGenerator(42, DefaultSettings)
+	cache := NewChunkCache()
+	center := pkg.Coords{X: 4, Z: -3}
+
+	column := cache.GetColumn(gen, center)
+	if column.Stage != pkg.StageTerrain {
+		t.Fatalf("a new column is at stage %d", column.Stage)
+	}
+	if cache.advance(gen, center) {
+		t.Fatal("the column was decorated without its neighbors")
+	}
+
+	for _, coord := range square(center, 1) {
+		cache.GetColumn(gen, coord)
+	}
+	if !cache.advance(gen, center) || column.Stage != pkg.StageDecorated {
+		t.Fatalf("the column wasn't decorated with its neighbors loaded (stage %d)", column.Stage)
+	}
+
+	// The neighbors only have their terrain, so the column can't be finished yet
+	if cache.advance(gen, center) {
+		t.Fatal("the column was finished before its neighbors were decorated")
+	}
+	if len(cache.Active) != 0 {
+		t.Errorf("%d chunks are active before any column was finished", len(cache.Active))
+	}
+
+	// Decorating the neighbors needs the ring after them
+	for _, coord := range square(center, 2) {
+		cache.GetColumn(gen, coord)
+	}
+	for _, coord := range square(center, 1) {
+		cache.advance(gen, coord)
+	}
+	if !cache.advance(gen, center) || column.Stage != pkg.StageFinal {
+		t.Fatalf("the column wasn't finished (stage %d)", column.Stage)
+	}
+	for _, chunk := range column.Sections {
+		if chunk != nil && cache.Active[chunk.Coord] != chunk {
+			t.Fatalf("chunk %v of a finished column isn't active", chunk.Coord)
+		}
+	}
+}
+
+func TestStagesDontDependOnOrder(t *testing.T) {
+	center := pkg.Coords{X: 0, Z: 0}
+	coords := square(center, 2)
+
+	// ManageChunks runs the stages closest to the player first, so the order changes as it moves
+	build := func(order []pkg.Coords) *pkg.Column {
+		gen := NewGenerator(42, DefaultSettings)
+		cache := NewChunkCache()
+		for _, coord := range order {
+			cache.GetColumn(gen, coord)
+		}
+		for range 2 {
+			for _, coord := range order {
+				cache.advance(gen, coord)
+			}
+		}
+		return cache.Columns[center]
+	}
+
+	reversed := make([]pkg.Coords, len(coords))
+	for i, coord := range coords {
+		reversed[len(coords)-1-i] = coord
+	}
+
+	a, b := build(coords), build(reversed)
+	if a.Stage != pkg.StageFinal || b.Stage != pkg.StageFinal {
+		t.Fatalf("the center column wasn't finished (stages %d and %d)", a.Stage, b.Stage)
+	}
+	if !sameVoxels(a, b) {
+		t.Error("the center column depends on the order its neighbors were loaded and decorated")
+	}
+}
+
+// Drives the streaming workers, the main thread (stages, edits, unloading and saving) and
+// readers on other goroutines at the same time. Run with -race to check the model of ChunkCache.
+func TestConcurrentAccess(t *testing.T) {
+	defer func(distance int) { pkg.ChunkDistance = distance }(pkg.ChunkDistance)
+	pkg.ChunkDistance = 1
+
+	cache := NewChunkCache()
+	cache.Store = NewRegionStore(t.TempDir())
+	streamer := NewStreamer(NewGenerator(42, DefaultSettings), cache, 4)
+	defer streamer.Close()
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := range 4 {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			r := rand.New(rand.NewSource(int64(i)))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				pos := rl.NewVector3(float32(r.Intn(160)-40), float32(r.Intn(100)), float32(r.Intn(80)-40))
+				getVoxelGlobal(cache, pos)
+
+				cache.CacheMutex.RLock()
+				for _, chunk := range cache.Active {
+					chunk.Voxels.Get(8, 8, 8)
+				}
+				cache.CacheMutex.RUnlock()
+				time.Sleep(100 * time.Microsecond)
+			}
+		}()
+	}
+
+	// The player walks away and back, so columns are cancelled, unloaded, saved and loaded again
+	r := rand.New(rand.NewSource(1))
+	stone := voxelOf("Stone")
+	for frame := range 200 {
+		x := float32(frame)
+		if frame >= 100 {
+			x = float32(200 - frame)
+		}
+		player := rl.NewVector3(x, 60, 8)
+		ManageChunks(streamer, player, rl.NewVector3(1, 0, 0))
+
+		edit := rl.NewVector3(x+float32(r.Intn(32)-16), float32(r.Intn(80)), float32(r.Intn(32)-16))
+		setVoxelGlobal(cache, edit, stone)
+		time.Sleep(time.Millisecond)
+	}
+
+	close(stop)
+	readers.Wait()
+	cache.SaveAll()
+
+	if n := cache.Events.Invalid(); n != 0 {
+		t.Errorf("%d invalid chunk transitions", n)
+	}
+}
+
+func TestEditsOnlyRemesh(t *testing.T) {
+	gen := NewGenerator(42, DefaultSettings)
+	cache := NewChunkCache()
+	center := pkg.Coords{X: 0, Z: 0}
+	for _, coord := range square(center, 2) {
+		cache.GetColumn(gen, coord)
+	}
+	for range 2 {
+		for _, coord := range square(center, 1) {
+			cache.advance(gen, coord)
+		}
+	}
+	column := cache.Columns[center]
+	if column.Stage != pkg.StageFinal {
+		t.Fatalf("the center column is at stage %d", column.Stage)
+	}
+
+	// The center is the only finished column, its neighbors are not drawn yet
+	for _, chunk := range cache.Active {
+		chunk.NeedsRemesh = false
+	}
+	trees := len(column.Trees)
+
+	// A voxel on the bottom border of a chunk, in the middle of the column
+	y := column.HeightMap[8][8] / pkg.ChunkSize * pkg.ChunkSize
+	below := pkg.Coords{Y: y/pkg.ChunkSize - 1}
+	setVoxelGlobal(cache, rl.NewVector3(8, float32(y), 8), voxelOf("Stone"))
+
+	chunk := cache.Active[pkg.Coords{Y: y / pkg.ChunkSize}]
+	if chunk == nil || !chunk.NeedsRemesh {
+		t.Fatal("the edited chunk doesn't need a new mesh")
+	}
+	if neighbor := cache.Active[below]; neighbor == nil || !neighbor.NeedsRemesh {
+		t.Error("the chunk under the edit doesn't need a new mesh")
+	}
+	for coord, other := range cache.Active {
+		if other.NeedsRemesh && coord != chunk.Coord && coord != below {
+			t.Errorf("chunk %v needs a new mesh but wasn't touched", coord)
+		}
+	}
+
+	// Nothing was generated again
+	if cache.advance(gen, center) || column.Stage != pkg.StageFinal || len(column.Trees) != trees {
+		t.Error("the edit changed the generation of the column")
+	}
+	if column.Get(8, y, 8).Type != Blocks.ID("Stone") {
+		t.Error("the edit was lost")
+	}
+}
+
+// Builds the columns of a square around center and runs the stages until the columns one ring
+// inside it are finished
+func buildAround(t *testing.T, gen *Generator, cache *ChunkCache, center pkg.Coords, radius int) {
+	t.Helper()
+	for _, coord := range square(center, radius) {
+		cache.GetColumn(gen, coord)
+	}
+	for range 2 {
+		for _, coord := range square(center, radius-1) {
+			cache.advance(gen, coord)
+		}
+	}
+	if column := cache.Columns[center]; column.Stage != pkg.StageFinal {
+		t.Fatalf("the center column is at stage %d", column.Stage)
+	}
+}
+
+func TestOnlyEditedColumnsAreSaved(t *testing.T) {
+	gen := NewGenerator(42, DefaultSettings)
+	cache := NewChunkCache()
+	cache.Store = NewRegionStore(t.TempDir())
+	center := pkg.Coords{X: 0, Z: 0}
+	buildAround(t, gen, cache, center, 2)
+
+	for coord, column := range cache.Columns {
+		if column.IsDirty {
+			t.Errorf("column %v has to be saved, but it wasn't edited", coord)
+		}
+	}
+
+	column := cache.Columns[center]
+	y := column.HeightMap[8][8] + 1
+	setVoxelGlobal(cache, rl.NewVector3(8, float32(y), 8), voxelOf("Stone"))
+	if !column.IsDirty {
+		t.Fatal("the edited column doesn't have to be saved")
+	}
+
+	// Far away, everything unloads and only the edited column is written
+	cache.CleanUp(rl.NewVector3(10000, 60, 10000))
+	cache.SaveAll()
+	if saved, err := cache.Store.Load(center, gen.World); saved == nil || saved.Get(8, y, 8) != voxelOf("Stone") {
+		t.Fatalf("the edited column wasn't saved with the edit (%v)", err)
+	}
+	if saved, err := cache.Store.Load(pkg.Coords{X: 1, Z: 0}, gen.World); saved != nil || err != nil {
+		t.Error("a column that wasn't edited was saved")
+	}
+
+	// Coming back, the edit is read from the disk
+	if loaded := cache.GetColumn(gen, center); loaded.Stage != pkg.StageFinal || loaded.Get(8, y, 8) != voxelOf("Stone") {
+		t.Error("the edit was lost when the column was loaded again")
+	}
+}
+
+func TestUnsavedColumnsComeBackTheSame(t *testing.T) {
+	gen := NewGenerator(42, DefaultSettings)
+	cache := NewChunkCache()
+	center := pkg.Coords{X: -20, Z: -20} // a forest, whose trees grow into the neighbors
+	buildAround(t, gen, cache, center, 3)
+
+	// The player clears everything above the ground of the neighbors, the leaves of the center included
+	cleared := make(map[*pkg.Column]*pkg.Column)
+	for _, coord := range square(center, 1) {
+		neighbor := cache.Columns[coord]
+		if coord == center {
+			continue
+		}
+		for x := range pkg.ChunkSize {
+			for z := range pkg.ChunkSize {
+				for y := neighbor.HeightMap[x][z] + 1; y < neighbor.MaxY(); y++ {
+					neighbor.Set(x, y, z, pkg.VoxelData{})
+				}
+			}
+		}
+		copied, err := newColumnRecord(neighbor).toColumn(coord, gen.World)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleared[neighbor] = copied
+	}
+
+	// The center wasn't edited, it unloads without being saved and is generated again
+	before := cache.Columns[center]
+	delete(cache.Columns, center)
+	for _, chunk := range chunksOf(before) {
+		delete(cache.Active, chunk.Coord)
+	}
+	after := cache.GetColumn(gen, center)
+	for after.Stage < pkg.StageFinal && cache.advance(gen, center) {
+	}
+
+	if after.Stage != pkg.StageFinal || !sameVoxels(after, before) {
+		t.Error("the column generated again differs, the trees of its neighbors are missing")
+	}
+	for neighbor, copied := range cleared {
+		if !sameVoxels(neighbor, copied) {
+			t.Errorf("the column generated again grew its trees into the cleared neighbor %d %d", neighbor.X, neighbor.Z)
+		}
+	}
+}
+
+func TestLoadRadii(t *testing.T) {
+	for distance := 1; distance <= 10; distance++ {
+		radii := RadiiFor(distance)
+		if radii.Render >= radii.Simulation || radii.Simulation >= radii.Unload {
+			t.Fatalf("radii %+v for distance %d", radii, distance)
+		}
+
+		// Finishing a visible column needs the 5x5 columns around it loaded,
+		// and the 3x3 ones decorated, which runs within Simulation-1
+		for _, coord := range circle(pkg.Coords{}, radii.Render) {
+			for _, neighbor := range square(coord, 2) {
+				if !withinRadius(neighbor, pkg.Coords{}, radii.Simulation) {
+					t.Errorf("distance %d: column %v is visible, but %v isn't loaded", distance, coord, neighbor)
+				}
+			}
+			for _, neighbor := range square(coord, 1) {
+				if !withinRadius(neighbor, pkg.Coords{}, radii.Simulation-1) {
+					t.Errorf("distance %d: column %v is visible, but %v isn't decorated", distance, coord, neighbor)
+				}
+			}
+		}
+	}
+
+	// Circles: the corners of the square are left out
+	radius := 5
+	if withinRadius(pkg.Coords{X: radius, Z: radius}, pkg.Coords{}, radius) {
+		t.Error("the corner of the square is inside the circle")
+	}
+	if !withinRadius(pkg.Coords{X: radius, Z: 1}, pkg.Coords{}, radius) {
+		t.Error("a column next to the edge is outside the circle")
+	}
+}
+
+func TestUnloadHysteresis(t *testing.T) {
+	defer func(distance int) { pkg.ChunkDistance = distance }(pkg.ChunkDistance)
+	pkg.ChunkDistance = 2
+	radii := RadiiFor(pkg.ChunkDistance)
+
+	gen := NewGenerator(42, DefaultSettings)
+	cache := NewChunkCache()
+	column := pkg.Coords{X: 0, Z: 0}
+	cache.GetColumn(gen, column)
+
+	// The player walks away along X, one column at a time
+	at := func(x int) rl.Vector3 {
+		return rl.NewVector3(float32(x*pkg.ChunkSize+8), 60, 8)
+	}
+	cache.CleanUp(at(radii.Simulation + 1))
+	if _, ok := cache.Columns[column]; !ok {
+		t.Error("the column was unloaded right after leaving the load area")
+	}
+	cache.CleanUp(at(radii.Unload))
+	if _, ok := cache.Columns[column]; !ok {
+		t.Error("the column was unloaded inside the unload radius")
+	}
+	cache.CleanUp(at(radii.Unload + 1))
+	if _, ok := cache.Columns[column]; ok {
+		t.Error("the column is still loaded out of the unload radius")
+	}
+}
+
+func TestLoadsTheCircleInFrontFirst(t *testing.T) {
+	defer func(distance int) { pkg.ChunkDistance = distance }(pkg.ChunkDistance)
+	pkg.ChunkDistance = 3
+	radii := RadiiFor(pkg.ChunkDistance)
+
+	// No workers, so the requests stay queued
+	cache := NewChunkCache()
+	s := NewStreamer(NewGenerator(42, DefaultSettings), cache, 0)
+	defer s.Close()
+
+	ManageChunks(s, rl.NewVector3(8, 60, 8), rl.NewVector3(1, 0, 0))
+
+	if n, want := len(s.queue), len(circle(pkg.Coords{}, radii.Simulation)); n != want {
+		t.Errorf("%d columns were requested, want the %d of the circle", n, want)
+	}
+	for _, r := range s.queue {
+		if !withinRadius(r.coord, pkg.Coords{}, radii.Simulation) {
+			t.Errorf("column %v out of the circle was requested", r.coord)
+		}
+	}
+
+	first := heap.Pop(&s.queue).(*request)
+	ahead := pkg.Coords{X: 1}
+	behind := pkg.Coords{X: -1}
+	if first.coord != (pkg.Coords{}) {
+		t.Errorf("column %v was requested before the one of the player", first.coord)
+	}
+	if s.pending[ahead].priority >= s.pending[behind].priority {
+		t.Error("the column behind the camera comes before the one in front")
+	}
+}
@@ -0,0 +1,34 @@
+package world
+
+import "io/fs"
+
+// Replaces the registries with the data files of fsys (data/blocks.json, data/ores.json...).
+// The others refer to blocks by the IDs of Blocks, so either every registry is replaced or,
+// when one fails to load, none is.
+func LoadData(fsys fs.FS) error {
+	blocks, ores, trees, biomes, structures := Blocks, Ores, Trees, Biomes, Structures
+	restore := func(err error) error {
+		Blocks, Ores, Trees, Biomes, Structures = blocks, ores, trees, biomes, structures
+		return err
+	}
+
+	// Each registry is set as soon as it loads, the next ones look up names in it.
+	// Errors already name the file.
+	var err error
+	if Blocks, err = LoadBlockRegistry(fsys, "data/blocks.json"); err != nil {
+		return restore(err)
+	}
+	if Ores, err = LoadOreRegistry(fsys, "data/ores.json"); err != nil {
+		return restore(err)
+	}
+	if Trees, err = LoadTreeRegistry(fsys, "data/trees.json"); err != nil {
+		return restore(err)
+	}
+	if Biomes, err = LoadBiomeRegistry(fsys, "data/biomes.json"); err != nil {
+		return restore(err)
+	}
+	if Structures, err = LoadStructureRegistry(fsys, "data/structures"); err != nil {
+		return restore(err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package world
+
+import (
+	"go-engine/src/noise"
+	"go-engine/src/pkg"
+)
+
+const (
+	// Size (in blocks) of the Worley cells that define the biomes
+	biomeCellSize = 128
+)
+
+// Owns the noise sources and settings of a world.
+// It has no dependency on a window or the GPU, so it can be used by tests and server processes.
+type Generator struct {
+	Seed          int64
+	World         Settings
+	Height        noise.Source // global height, sampled with world coordinates
+	Primary       noise.Source // biome height layers
+	Secondary     noise.Source // biome height layers (detail)
+	Clouds        noise.Source
+	Caves         *CaveCarver
+	Density       noise.Source // 3D, carves and adds terrain around the surface (density mode only)
+	Sand          noise.Source // sand patches on the shores
+	Rivers        noise.Source // rivers run where it is close to zero
+	Floor         noise.Source // patches of the sea floor blocks
+	Worley        *WorleyNoise
+	BiomeSelector *BiomeSelector
+}
+
+func NewGenerator(seed int64, settings Settings) *Generator {
+	// Every noise source derives its own seed from the world seed
+	// The height is warped a little, so hills and valleys don't all look like round blobs
+	height := noise.NewWarp(baseNoise(noise.DeriveSeed(seed, 1), 0.002), noise.DeriveSeed(seed, 4), noise.DefaultOctaves(2, 0.004), 40)
+	worley := NewWorleyNoise(noise.DeriveSeed(seed, 1), biomeCellSize)
+
+	return &Generator{
+		Seed:          seed,
+		World:         settings,
+		Height:        height,
+		Primary:       baseNoise(noise.DeriveSeed(seed, 2), 1),
+		Secondary:     baseNoise(noise.DeriveSeed(seed, 3), 1),
+		Clouds:        baseNoise(noise.DeriveSeed(seed, 5), 0.05),
+		Caves:         NewCaveCarver(noise.DeriveSeed(seed, 6)),
+		Density:       noise.NewFBM(noise.NewPerlin(noise.DeriveSeed(seed, 8)), noise.DefaultOctaves(3, 1.0/48)),
+		Sand:          noise.NewFBM(noise.NewPerlin(noise.DeriveSeed(seed, 7)), noise.DefaultOctaves(4, 1.0/8)),
+		Rivers:        newRiverNoise(noise.DeriveSeed(seed, 9)),
+		Floor:         noise.NewFBM(noise.NewPerlin(noise.DeriveSeed(seed, 13)), noise.DefaultOctaves(2, 1.0/16)),
+		Worley:        worley,
+		BiomeSelector: NewBiomeSelector(noise.DeriveSeed(seed, 1), worley, height),
+	}
+}
+
+// Two octaves, each one with 1.5x the frequency and 1/3 of the amplitude of the previous.
+// It keeps the look the terrain had with the old go-perlin settings (alpha 3, beta 1.5, n 2).
+func baseNoise(seed int64, frequency float64) noise.Source {
+	return noise.NewFBM(noise.NewPerlin(seed), noise.Octaves{Count: 2, Frequency: frequency, Lacunarity: 1.5, Gain: 1.0 / 3})
+}
+
+// Generates a single column through every stage on its own.
+// The parts of its trees that grow into other columns are discarded.
+func (g *Generator) Generate(coord pkg.Coords) *pkg.Column {
+	column := g.generateTerrain(coord)
+
+	chunkCache := NewChunkCache()
+	chunkCache.Columns[coord] = column
+	g.decorate(column, chunkCache)
+
+	finalize(column)
+	return column
+}
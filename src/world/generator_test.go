@@ -0,0 +1,275 @@
+package world
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"go-engine/src/pkg"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	coords := []pkg.Coords{{X: 0, Z: 0}, {X: 3, Z: -2}, {X: -7, Z: 11}}
+
+	genA := NewGenerator(42, DefaultSettings)
+	genB := NewGenerator(42, DefaultSettings)
+
+	// Generate in opposite orders so any dependency on load order would show up
+	var columnsA []*pkg.Column
+	for _, coord := range coords {
+		columnsA = append(columnsA, genA.Generate(coord))
+	}
+	for i := len(coords) - 1; i >= 0; i-- {
+		b := genB.Generate(coords[i])
+		a := columnsA[i]
+
+		if !sameVoxels(a, b) {
+			t.Errorf("column %v: voxels differ between generations", coords[i])
+		}
+		if a.HeightMap != b.HeightMap {
+			t.Errorf("column %v: height maps differ between generations", coords[i])
+		}
+		if len(a.Trees) != len(b.Trees) || len(a.Plants) != len(b.Plants) {
+			t.Errorf("column %v: features differ between generations", coords[i])
+		}
+	}
+}
+
+func TestGenerateDependsOnSeed(t *testing.T) {
+	coord := pkg.Coords{X: 1, Z: 1}
+
+	a := NewGenerator(1, DefaultSettings).Generate(coord)
+	b := NewGenerator(2, DefaultSettings).Generate(coord)
+
+	if a.HeightMap == b.HeightMap {
+		t.Error("different seeds produced the same terrain")
+	}
+}
+
+func TestColumnsSkipEmptyChunks(t *testing.T) {
+	settings := Settings{Height: 192, Depth: 64}
+	column := NewGenerator(7, settings).Generate(pkg.Coords{X: 2, Z: 5})
+
+	if len(column.Sections) != settings.Sections() || column.MinY() != -64 || column.MaxY() != 192 {
+		t.Fatalf("column spans [%d, %d) with %d chunks", column.MinY(), column.MaxY(), len(column.Sections))
+	}
+
+	// The top of a tall world is only sky
+	if column.Sections[len(column.Sections)-1] != nil {
+		t.Error("the highest chunk is made of air but was kept")
+	}
+	for i, chunk := range column.Sections {
+		if chunk == nil {
+			continue
+		}
+		if chunk.Voxels.IsEmpty() {
+			t.Errorf("chunk %d is empty but was kept", i)
+		}
+		if chunk.Coord.Y != column.MinSection+i || chunk.Column != column {
+			t.Errorf("chunk %d has coordinate %v", i, chunk.Coord)
+		}
+	}
+
+	// The deep underground is filled all the way down
+	if column.Get(0, column.MinY(), 0).Type == Blocks.ID("Air") {
+		t.Error("the bottom of the world is empty")
+	}
+}
+
+func TestSettingsMustBeWholeChunks(t *testing.T) {
+	for _, settings := range []Settings{{Height: 100}, {Height: 16}, {Height: 128, Depth: 8}, {Height: 128, Depth: -16}} {
+		if settings.Validate() == nil {
+			t.Errorf("%+v was accepted", settings)
+		}
+	}
+	if err := DefaultSettings.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func sameVoxels(a, b *pkg.Column) bool {
+	for x := range pkg.ChunkSize {
+		for y := a.MinY(); y < a.MaxY(); y++ {
+			for z := range pkg.ChunkSize {
+				if a.Get(x, y, z) != b.Get(x, y, z) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func TestDensityTerrain(t *testing.T) {
+	settings := DefaultSettings
+	settings.Terrain = TerrainDensity
+	gen := NewGenerator(3, settings)
+
+	overhangs := 0
+	for _, coord := range []pkg.Coords{{X: 0, Z: 0}, {X: 4, Z: -3}, {X: -6, Z: 9}} {
+		column := gen.Generate(coord)
+
+		for x := range pkg.ChunkSize {
+			for z := range pkg.ChunkSize {
+				height := column.HeightMap[x][z]
+
+				// The height map is the highest terrain voxel (caves may have carved it since)
+				if !isTerrain(column.Get(x, height, z)) && column.Get(x, height, z).Type != Blocks.ID("Air") {
+					t.Fatalf("column %v: the surface (%d, %d, %d) is not terrain", coord, x, height, z)
+				}
+				for y := height + 1; y < column.MaxY(); y++ {
+					if isTerrain(column.Get(x, y, z)) {
+						t.Fatalf("column %v: terrain at %d, above the surface %d", coord, y, height)
+					}
+				}
+
+				// Air with terrain above it
+				for y := column.MinY(); y < height; y++ {
+					if column.Get(x, y, z).Type == Blocks.ID("Air") && y > gen.World.WaterLevel() {
+						overhangs++
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if overhangs == 0 {
+		t.Error("density terrain has no overhangs")
+	}
+}
+
+func isTerrain(voxel pkg.VoxelData) bool {
+	switch voxel.Type {
+	case Blocks.ID("Stone"), Blocks.ID("Dirt"), Blocks.ID("Grass"), Blocks.ID("Sand"):
+		return true
+	}
+	return false
+}
+
+func TestSnowAboveTheSnowLine(t *testing.T) {
+	settings := DefaultSettings
+	settings.SnowLine = 50
+	gen := NewGenerator(42, settings)
+	snow, grass := Blocks.ID("Snow"), Blocks.ID("Grass")
+
+	found := false
+	for x := 0; x < 8; x++ {
+		column := gen.Generate(pkg.Coords{X: x * 5, Z: -x * 3})
+		for lx := 0; lx < pkg.ChunkSize; lx++ {
+			for lz := 0; lz < pkg.ChunkSize; lz++ {
+				height := column.HeightMap[lx][lz]
+				surface := column.Get(lx, height, lz).Type
+				if height >= settings.SnowLine && surface == grass {
+					t.Fatalf("grass at height %d, above the snow line", height)
+				}
+				found = found || surface == snow
+			}
+		}
+	}
+	if !found {
+		t.Error("no snow was generated")
+	}
+}
+
+func TestFrozenWater(t *testing.T) {
+	column := pkg.NewColumn(0, 0, 0, 2)
+	for y := 0; y <= 10; y++ {
+		column.Set(0, y, 0, voxelOf("Stone"))
+	}
+
+	biome, _ := Biomes.Get("FrozenOcean")
+	genWaterFormations(column, ChunkOrigin(pkg.Coords{}), 20, 0, 0, *biome, NewGenerator(1, DefaultSettings).Sand)
+
+	if got := column.Get(0, 20, 0).Type; got != Blocks.ID("Ice") {
+		t.Errorf("the water surface is %s, not ice", Blocks.Get(got).Name)
+	}
+	for y := 11; y < 20; y++ {
+		if column.Get(0, y, 0).Type != Blocks.ID("Water") {
+			t.Fatalf("no water under the ice at %d", y)
+		}
+	}
+}
+
+func TestColdClimatesHaveColdBiomes(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	cases := []struct {
+		climate Climate
+		biome   string
+	}{
+		{Climate{Temperature: 0.05, Humidity: 0.5, Continentalness: 0.8, Altitude: 0.5}, "Tundra"},
+		{Climate{Temperature: 0.2, Humidity: 0.7, Continentalness: 0.8, Altitude: 0.5}, "Taiga"},
+	}
+	for _, c := range cases {
+		if got := matchBiome(c.climate, r); got.Name != c.biome {
+			t.Errorf("%+v: got %s, want %s", c.climate, got.Name, c.biome)
+		}
+	}
+
+	if sea := seaBiome(SeaOcean, true); sea.Name != "FrozenOcean" {
+		t.Errorf("cold coasts have %s seas", sea.Name)
+	}
+}
+
+func TestOceansAndBeaches(t *testing.T) {
+	gen := NewGenerator(42, DefaultSettings)
+	water := gen.World.WaterLevel()
+
+	depths := map[string][]int{}
+	for x := -100; x < 100; x += 2 {
+		for z := -100; z < 100; z += 2 {
+			height, biome := gen.shapeTerrain(ChunkOrigin(pkg.Coords{X: x, Z: z}), 8, 8)
+			switch biome.Sea {
+			case SeaOcean, SeaDeep:
+				if height >= water {
+					t.Fatalf("%s above the water at height %d", biome.Name, height)
+				}
+			case SeaBeach:
+				if height < water-1 || height > water+beachHeight {
+					t.Fatalf("beach at height %d, the water is at %d", height, water)
+				}
+			}
+			depths[biome.Sea] = append(depths[biome.Sea], water-height)
+		}
+	}
+
+	average := func(values []int) float64 {
+		total := 0
+		for _, v := range values {
+			total += v
+		}
+		return float64(total) / float64(len(values))
+	}
+	if len(depths[SeaBeach]) == 0 || len(depths[SeaOcean]) == 0 || len(depths[SeaDeep]) == 0 {
+		t.Fatalf("missing sea biomes: %d beach, %d ocean and %d deep ocean columns",
+			len(depths[SeaBeach]), len(depths[SeaOcean]), len(depths[SeaDeep]))
+	}
+	if average(depths[SeaDeep]) <= average(depths[SeaOcean]) {
+		t.Error("the deep ocean is not deeper than the ocean")
+	}
+}
+
+func TestSeaFloorBlocks(t *testing.T) {
+	gen := NewGenerator(42, DefaultSettings)
+	floor := map[pkg.BlockID]bool{}
+
+	for x := -100; x < 100; x += 10 {
+		column := gen.Generate(pkg.Coords{X: x, Z: x / 2})
+		for lx := 0; lx < pkg.ChunkSize; lx++ {
+			for lz := 0; lz < pkg.ChunkSize; lz++ {
+				biome := column.BiomeMap[lx][lz]
+				if biome.Sea != SeaOcean && biome.Sea != SeaDeep {
+					continue
+				}
+				voxel := column.Get(lx, column.HeightMap[lx][lz], lz).Type
+				if !slices.Contains(biome.FloorBlocks, Blocks.Get(voxel).Name) && voxel != Blocks.ID("Air") {
+					t.Fatalf("%s floor made of %s", biome.Name, Blocks.Get(voxel).Name)
+				}
+				floor[voxel] = true
+			}
+		}
+	}
+	if len(floor) < 2 {
+		t.Errorf("the sea floor has %d kinds of blocks", len(floor))
+	}
+}
@@ -0,0 +1,148 @@
+package world
+
+import (
+	"fmt"
+	"sync"
+
+	"go-engine/src/pkg"
+)
+
+// A chunk (or a column request, then Chunk is nil and Coord.Y is 0) changed its state
+type ChunkEvent struct {
+	Coord    pkg.Coords
+	Chunk    *pkg.Chunk
+	From, To pkg.ChunkState
+}
+
+// Checks the transitions of the chunks and tells the subscribers about them.
+// Transitions happen on the workers and under the cache lock, so events are queued and only
+// delivered by Dispatch, on the main thread and without the lock: subscribers may read the cache.
+type Lifecycle struct {
+	mutex       sync.Mutex
+	queue       []ChunkEvent
+	subscribers []func(ChunkEvent)
+	invalid     int
+}
+
+// Adds a function that is called with every event, in the order they happened
+func (l *Lifecycle) Subscribe(subscriber func(ChunkEvent)) {
+	l.mutex.Lock()
+	l.subscribers = append(l.subscribers, subscriber)
+	l.mutex.Unlock()
+}
+
+// Delivers the queued events (ManageChunks calls it once per frame)
+func (l *Lifecycle) Dispatch() {
+	l.mutex.Lock()
+	events := l.queue
+	l.queue = nil
+	subscribers := l.subscribers
+	l.mutex.Unlock()
+
+	for _, event := range events {
+		for _, subscriber := range subscribers {
+			subscriber(event)
+		}
+	}
+}
+
+// Number of invalid transitions that were refused
+func (l *Lifecycle) Invalid() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.invalid
+}
+
+// Changes a state and queues the event. Invalid transitions are reported and leave the state as it was.
+func (l *Lifecycle) move(coord pkg.Coords, chunk *pkg.Chunk, state *pkg.ChunkState, to pkg.ChunkState) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	from := *state
+	if !from.CanBecome(to) {
+		l.invalid++
+		err := fmt.Errorf("chunk %v can't go from %v to %v", coord, from, to)
+		fmt.Printf("Invalid chunk transition: %v\n", err)
+		return err
+	}
+	*state = to
+	l.queue = append(l.queue, ChunkEvent{Coord: coord, Chunk: chunk, From: from, To: to})
+	return nil
+}
+
+// Moves a chunk to another state. The caller owns the chunk: a worker while it builds its column,
+// then the main thread, then the writer if the column is saved (see ChunkCache).
+func (cc *ChunkCache) Transition(chunk *pkg.Chunk, to pkg.ChunkState) error {
+	return cc.Events.move(chunk.Coord, chunk, &chunk.State, to)
+}
+
+// State of the chunks of a column at a stage
+func stageState(stage pkg.Stage) pkg.ChunkState {
+	if stage >= pkg.StageDecorated {
+		return pkg.ChunkDecorated
+	}
+	return pkg.ChunkGenerated
+}
+
+// Gives a state to the chunks of a column that don't have one yet: the ones it was loaded with,
+// and the ones that writes (decoration from the neighbors, edits) created since
+func (cc *ChunkCache) adopt(column *pkg.Column) {
+	for _, chunk := range column.Sections {
+		if chunk != nil && chunk.State == 0 {
+			cc.Transition(chunk, stageState(column.Stage))
+		}
+	}
+}
+
+// Chunks that left the world. Nothing is written for them, so they are done right away.
+func (cc *ChunkCache) discard(chunks ...*pkg.Chunk) {
+	for _, chunk := range chunks {
+		if chunk.State == pkg.ChunkUnloading || cc.Transition(chunk, pkg.ChunkUnloading) == nil {
+			cc.Transition(chunk, pkg.ChunkDiscarded)
+		}
+	}
+}
+
+// Number of chunks in each state, kept up to date by the events (for the debug overlay)
+type ChunkStats struct {
+	mutex  sync.Mutex
+	counts map[pkg.ChunkState]int
+}
+
+// Counts the chunks of a cache from now on. Column requests are left out, they aren't chunks.
+func NewChunkStats(events *Lifecycle) *ChunkStats {
+	stats := &ChunkStats{counts: make(map[pkg.ChunkState]int)}
+	events.Subscribe(func(event ChunkEvent) {
+		if event.Chunk == nil {
+			return
+		}
+		stats.mutex.Lock()
+		defer stats.mutex.Unlock()
+		if event.From != 0 {
+			stats.counts[event.From]--
+		}
+		if event.To != pkg.ChunkSaved && event.To != pkg.ChunkDiscarded {
+			stats.counts[event.To]++
+		}
+	})
+	return stats
+}
+
+// Number of chunks in a state
+func (s *ChunkStats) Count(state pkg.ChunkState) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.counts[state]
+}
+
+// One line with the states that have chunks, in lifecycle order
+func (s *ChunkStats) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	text := "Chunks:"
+	for state := pkg.ChunkGenerated; state < pkg.ChunkSaved; state++ {
+		text += fmt.Sprintf(" %v %d", state, s.counts[state])
+	}
+	return text
+}
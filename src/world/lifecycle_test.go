@@ -0,0 +1,194 @@
+package world
+
+import (
+	"testing"
+	"time"
+
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestChunkTransitions(t *testing.T) {
+	valid := [][2]pkg.ChunkState{
+		{0, pkg.ChunkRequested},
+		{pkg.ChunkRequested, pkg.ChunkGenerating},
+		{pkg.ChunkGenerating, pkg.ChunkGenerated},
+		{pkg.ChunkGenerated, pkg.ChunkDecorated},
+		{pkg.ChunkDecorated, pkg.ChunkMeshed},
+		{pkg.ChunkMeshed, pkg.ChunkVisible},
+		{pkg.ChunkVisible, pkg.ChunkMeshed},
+		{pkg.ChunkVisible, pkg.ChunkUnloading},
+		{pkg.ChunkUnloading, pkg.ChunkSaved},
+		{pkg.ChunkUnloading, pkg.ChunkDiscarded},
+	}
+	for _, transition := range valid {
+		if !transition[0].CanBecome(transition[1]) {
+			t.Errorf("%v can't become %v", transition[0], transition[1])
+		}
+	}
+
+	invalid := [][2]pkg.ChunkState{
+		{0, pkg.ChunkVisible},
+		{pkg.ChunkGenerated, pkg.ChunkMeshed},
+		{pkg.ChunkDecorated, pkg.ChunkGenerated},
+		{pkg.ChunkVisible, pkg.ChunkSaved},
+		{pkg.ChunkVisible, pkg.ChunkDiscarded},
+		{pkg.ChunkDiscarded, pkg.ChunkSaved},
+		{pkg.ChunkSaved, pkg.ChunkRequested},
+		{pkg.ChunkUnloading, pkg.ChunkVisible},
+	}
+	for _, transition := range invalid {
+		if transition[0].CanBecome(transition[1]) {
+			t.Errorf("%v can become %v", transition[0], transition[1])
+		}
+	}
+}
+
+func TestInvalidTransitionsAreRefused(t *testing.T) {
+	cache := NewChunkCache()
+	var events []ChunkEvent
+	cache.Events.Subscribe(func(event ChunkEvent) { events = append(events, event) })
+
+	chunk := &pkg.Chunk{Coord: pkg.Coords{X: 1, Y: 2, Z: 3}, State: pkg.ChunkGenerated}
+	if err := cache.Transition(chunk, pkg.ChunkVisible); err == nil {
+		t.Error("a generated chunk became visible without a mesh")
+	}
+	if chunk.State != pkg.ChunkGenerated {
+		t.Errorf("the refused transition left the chunk %v", chunk.State)
+	}
+
+	if err := cache.Transition(chunk, pkg.ChunkDecorated); err != nil {
+		t.Error(err)
+	}
+	cache.Events.Dispatch()
+
+	if cache.Events.Invalid() != 1 {
+		t.Errorf("%d invalid transitions were counted", cache.Events.Invalid())
+	}
+	want := ChunkEvent{Coord: chunk.Coord, Chunk: chunk, From: pkg.ChunkGenerated, To: pkg.ChunkDecorated}
+	if len(events) != 1 || events[0] != want {
+		t.Errorf("events %v, want only %v", events, want)
+	}
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	defer func(distance int) { pkg.ChunkDistance = distance }(pkg.ChunkDistance)
+	pkg.ChunkDistance = 1
+
+	gen := NewGenerator(42, DefaultSettings)
+	cache := NewChunkCache()
+	stats := NewChunkStats(&cache.Events)
+
+	// The states each chunk went through, and the ones of the column requests
+	history := make(map[*pkg.Chunk][]pkg.ChunkState)
+	requests := make(map[pkg.Coords][]pkg.ChunkState)
+	cache.Events.Subscribe(func(event ChunkEvent) {
+		if event.Chunk == nil {
+			requests[event.Coord] = append(requests[event.Coord], event.To)
+			return
+		}
+		if states := history[event.Chunk]; len(states) > 0 && states[len(states)-1] != event.From {
+			t.Errorf("chunk %v went from %v, but it was %v", event.Coord, event.From, states[len(states)-1])
+		}
+		history[event.Chunk] = append(history[event.Chunk], event.To)
+	})
+
+	streamer := NewStreamer(gen, cache, 2)
+	defer streamer.Close()
+
+	player := rl.NewVector3(8, 60, 8)
+	forward := rl.NewVector3(1, 0, 0)
+	loaded := len(circle(pkg.Coords{}, RadiiFor(pkg.ChunkDistance).Simulation))
+	for range 5000 {
+		ManageChunks(streamer, player, forward)
+		cache.CacheMutex.RLock()
+		finished := len(cache.Columns) == loaded && cache.Columns[pkg.Coords{}].Stage == pkg.StageFinal
+		cache.CacheMutex.RUnlock()
+		if finished {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// What the renderer does with the chunks of the finished column
+	column := cache.Columns[pkg.Coords{}]
+	if column.Stage != pkg.StageFinal {
+		t.Fatalf("the center column is at stage %d", column.Stage)
+	}
+	for _, chunk := range cache.Active {
+		cache.Transition(chunk, pkg.ChunkMeshed)
+		cache.Transition(chunk, pkg.ChunkVisible)
+	}
+	cache.Events.Dispatch()
+
+	for coord, states := range requests {
+		want := []pkg.ChunkState{pkg.ChunkRequested, pkg.ChunkGenerating, pkg.ChunkGenerated}
+		if len(states) != len(want) || states[0] != want[0] || states[1] != want[1] || states[2] != want[2] {
+			t.Errorf("request of column %v went through %v", coord, states)
+		}
+	}
+	for _, chunk := range chunksOf(column) {
+		if chunk.State != pkg.ChunkVisible {
+			t.Errorf("chunk %v of the center column is %v", chunk.Coord, chunk.State)
+		}
+	}
+	if stats.Count(pkg.ChunkVisible) != len(cache.Active) {
+		t.Errorf("%d chunks counted visible, %d are active", stats.Count(pkg.ChunkVisible), len(cache.Active))
+	}
+
+	// Far away, every chunk unloads. Nothing was edited, so nothing is saved.
+	chunks := len(history)
+	cache.CleanUp(rl.NewVector3(10000, 60, 10000))
+	cache.Events.Dispatch()
+	if len(cache.Columns) != 0 || chunks == 0 {
+		t.Fatalf("%d columns are still loaded (%d chunks seen)", len(cache.Columns), chunks)
+	}
+	for chunk, states := range history {
+		if states[len(states)-1] != pkg.ChunkDiscarded {
+			t.Errorf("chunk %v ended %v (%v)", chunk.Coord, states[len(states)-1], states)
+		}
+	}
+	for state := pkg.ChunkGenerated; state <= pkg.ChunkDiscarded; state++ {
+		if n := stats.Count(state); n != 0 {
+			t.Errorf("%d chunks still counted %v", n, state)
+		}
+	}
+	if n := cache.Events.Invalid(); n != 0 {
+		t.Errorf("%d invalid chunk transitions", n)
+	}
+}
+
+func TestStreamerCloseDiscardsItsColumns(t *testing.T) {
+	cache := NewChunkCache()
+	stats := NewChunkStats(&cache.Events)
+	streamer := NewStreamer(NewGenerator(42, DefaultSettings), cache, 1)
+
+	// More columns than the channel holds, and the main thread never picks them up
+	wanted := make(map[pkg.Coords]float64)
+	for x := range 8 {
+		wanted[pkg.Coords{X: x}] = float64(x)
+	}
+	streamer.Request(wanted)
+	for range 5000 {
+		if len(streamer.done) == cap(streamer.done) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cache.Events.Dispatch()
+	if stats.Count(pkg.ChunkGenerated)+stats.Count(pkg.ChunkDecorated) == 0 {
+		t.Fatal("no column was generated")
+	}
+
+	streamer.Close()
+	cache.Events.Dispatch()
+	for state := pkg.ChunkRequested; state <= pkg.ChunkUnloading; state++ {
+		if n := stats.Count(state); n != 0 {
+			t.Errorf("%d chunks still counted %v after closing", n, state)
+		}
+	}
+	if n := cache.Events.Invalid(); n != 0 {
+		t.Errorf("%d invalid chunk transitions", n)
+	}
+}
@@ -0,0 +1,102 @@
+package world
+
+import (
+	"math"
+
+	"go-engine/src/noise"
+	"go-engine/src/pkg"
+)
+
+// Kinds of sea biomes. They are not picked by the biome cells but by the continentalness at each
+// column, so coasts and beaches follow the shape of the continents instead of the cell borders.
+const (
+	SeaBeach = "beach"
+	SeaOcean = "ocean"
+	SeaDeep  = "deepOcean"
+)
+
+const (
+	coastContinentalness = 0.35 // the land sinks below the sea under it
+	deepContinentalness  = 0.2  // deep ocean under it
+	shelfWidth           = 0.05 // continentalness over which the land slopes down to the sea floor
+
+	oceanDepth     = 3    // depth of the sea floor at the coast
+	deepOceanDepth = 0.2  // depth of the deep sea floor, as a fraction of the world height
+	beachHeight    = 2    // beaches reach this far above the water
+	floorVariation = 3.0  // the sea floor goes up and down by this many blocks
+	floorFrequency = 0.02 // of the sea floor variation
+)
+
+// Lowers the terrain of a column close to or below the sea, and picks its sea biome.
+// land is the biome of the Worley cells, it is kept for columns that stay above the beaches.
+func (g *Generator) shapeSea(gx, gz int, height float64, land *pkg.BiomeProperties) (float64, *pkg.BiomeProperties) {
+	c := g.BiomeSelector.Continentalness(gx, gz)
+	if c >= coastContinentalness+shelfWidth {
+		return height, land
+	}
+
+	water := float64(g.World.WaterLevel())
+
+	// The floor gets deeper from the coast to the deep ocean, with some noise so it isn't flat
+	depth := math.Max(0, math.Min(1, (coastContinentalness-c)/(coastContinentalness-deepContinentalness)))
+	floor := water - oceanDepth - depth*deepOceanDepth*float64(g.World.Height) +
+		g.Secondary.Noise2D(float64(gx)*floorFrequency, float64(gz)*floorFrequency)*floorVariation
+
+	// The land slopes down across the shelf, lakes that are already deeper keep their floor
+	blend := math.Max(0, math.Min(1, (coastContinentalness+shelfWidth-c)/(2*shelfWidth)))
+	blend = blend * blend * (3 - 2*blend) // smoothstep
+	height = height*(1-blend) + math.Min(floor, height)*blend
+
+	// Cold coasts have frozen seas and no beaches
+	frozen := land.Frozen || biomeBand(land) < 0
+
+	var sea *pkg.BiomeProperties
+	switch {
+	case height < water-1 && c < deepContinentalness:
+		sea = seaBiome(SeaDeep, frozen)
+	case height < water-1:
+		sea = seaBiome(SeaOcean, frozen)
+	case height <= water+beachHeight && !frozen:
+		sea = seaBiome(SeaBeach, false)
+	}
+	if sea == nil {
+		return height, land
+	}
+	return height, sea
+}
+
+// Sea biome of a kind, preferring one that is frozen (or not) like the coast.
+// Returns nil when the data has no biome of that kind.
+func seaBiome(kind string, frozen bool) *pkg.BiomeProperties {
+	var match *pkg.BiomeProperties
+	for _, biome := range Biomes.All() {
+		if biome.Sea != kind {
+			continue
+		}
+		if biome.Frozen == frozen {
+			return biome
+		}
+		if match == nil {
+			match = biome
+		}
+	}
+	return match
+}
+
+// Covers the top of the sea floor with the floor blocks of the biome, in patches
+func (g *Generator) coverSeaFloor(column *pkg.Column, gx, gz, x, z, height int, biome pkg.BiomeProperties) {
+	if len(biome.FloorBlocks) == 0 || height >= g.World.WaterLevel() {
+		return
+	}
+
+	n := noise.Normalize(g.Floor.Noise2D(float64(gx), float64(gz)))
+	i := max(0, min(int(n*float64(len(biome.FloorBlocks))), len(biome.FloorBlocks)-1))
+	block := biome.FloorBlocks[i]
+	voxel := pkg.VoxelData{Type: Blocks.ID(block)}
+
+	for y := height; y >= height-biome.FillerDepth && y >= column.MinY(); y-- {
+		if Blocks.Get(column.Get(x, y, z).Type).IsSolid {
+			column.Set(x, y, z, voxel)
+		}
+	}
+}
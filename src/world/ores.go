@@ -0,0 +1,155 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"go-engine/assets"
+	"go-engine/src/noise"
+	"go-engine/src/pkg"
+)
+
+// Every mineral placed in the underground, loaded from assets/data/ores.json
+var Ores = mustLoadDefaultOres()
+
+type OreProperties struct {
+	Name      string
+	Block     pkg.BlockID // block of the vein
+	Host      pkg.BlockID // the vein only replaces this block
+	MinY      int
+	MaxY      int
+	VeinSize  int     // voxels per vein
+	Frequency float64 // veins per column, the fraction is the chance of one more
+}
+
+// Ore definition as it is written in the data file
+type oreDefinition struct {
+	Name      string  `json:"name"`
+	Block     string  `json:"block"`
+	Host      string  `json:"host"`
+	Height    [2]int  `json:"height"` // [min, max] world Y
+	VeinSize  int     `json:"veinSize"`
+	Frequency float64 `json:"frequency"`
+}
+
+type OreRegistry struct {
+	ores []OreProperties // in the order of the data file, which keeps the generation deterministic
+}
+
+func mustLoadDefaultOres() *OreRegistry {
+	registry, err := LoadOreRegistry(assets.Data, "data/ores.json")
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// Loads the ore definitions. The blocks they use must already be in Blocks.
+func LoadOreRegistry(fsys fs.FS, path string) (*OreRegistry, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Ores []oreDefinition `json:"ores"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	registry := &OreRegistry{}
+	for _, def := range file.Ores {
+		block, ok := Blocks.Lookup(def.Block)
+		if !ok {
+			return nil, fmt.Errorf("%s: ore %q uses unknown block %q", path, def.Name, def.Block)
+		}
+		host, ok := Blocks.Lookup(def.Host)
+		if !ok {
+			return nil, fmt.Errorf("%s: ore %q uses unknown host block %q", path, def.Name, def.Host)
+		}
+		if def.Height[0] > def.Height[1] || def.VeinSize <= 0 || def.Frequency < 0 {
+			return nil, fmt.Errorf("%s: ore %q has an invalid height range, vein size or frequency", path, def.Name)
+		}
+
+		registry.ores = append(registry.ores, OreProperties{
+			Name:      def.Name,
+			Block:     block,
+			Host:      host,
+			MinY:      def.Height[0],
+			MaxY:      def.Height[1],
+			VeinSize:  def.VeinSize,
+			Frequency: def.Frequency,
+		})
+	}
+	return registry, nil
+}
+
+func (r *OreRegistry) All() []OreProperties {
+	return r.ores
+}
+
+// Places the ore veins of a column. Each ore has its own random stream per column, derived from
+// its name, so the veins only depend on the seed and the column (and adding, removing or
+// reordering ores in the data file doesn't move the others). Veins stay inside their column.
+// All the veins are walked on the column as it was before any ore, and where veins of
+// several ores cross, the ore whose rank is the highest at that voxel gets it.
+func (g *Generator) generateOres(column *pkg.Column, coord pkg.Coords) {
+	type claim struct {
+		ore  *OreProperties
+		rank int64
+	}
+	claims := make(map[[3]int]claim)
+
+	ores := Ores.All()
+	for i := range ores {
+		ore := &ores[i]
+		rng := chunkRand(noise.DeriveSeed(g.Seed, nameSalt(ore.Name)), coord)
+
+		minY := max(ore.MinY, column.MinY())
+		maxY := min(ore.MaxY, column.MaxY()-1)
+		if minY > maxY {
+			continue
+		}
+
+		veins := int(ore.Frequency)
+		if rng.Float64() < ore.Frequency-float64(veins) {
+			veins++
+		}
+
+		for range veins {
+			x := rng.Intn(pkg.ChunkSize)
+			y := minY + rng.Intn(maxY-minY+1)
+			z := rng.Intn(pkg.ChunkSize)
+
+			// The vein is a random walk, a step at a time in any direction
+			for range ore.VeinSize {
+				if x >= 0 && x < pkg.ChunkSize && z >= 0 && z < pkg.ChunkSize &&
+					y >= minY && y <= maxY && column.Get(x, y, z).Type == ore.Host {
+					pos := [3]int{x, y, z}
+					rank := oreRank(ore.Name, pos)
+					if c, ok := claims[pos]; !ok || rank > c.rank || (rank == c.rank && ore.Name > c.ore.Name) {
+						claims[pos] = claim{ore, rank}
+					}
+				}
+				x += rng.Intn(3) - 1
+				y += rng.Intn(3) - 1
+				z += rng.Intn(3) - 1
+			}
+		}
+	}
+
+	for pos, c := range claims {
+		column.Set(pos[0], pos[1], pos[2], pkg.VoxelData{Type: c.ore.Block})
+	}
+}
+
+// Priority of an ore at a voxel of its column, only depends on the two
+func oreRank(name string, pos [3]int) int64 {
+	rank := nameSalt(name)
+	for _, v := range pos {
+		rank = noise.DeriveSeed(rank, int64(v))
+	}
+	return rank
+}
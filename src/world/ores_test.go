@@ -0,0 +1,91 @@
+package world
+
+import (
+	"testing"
+
+	"go-engine/src/pkg"
+)
+
+func TestOresStayInTheirRange(t *testing.T) {
+	// Dungeons have crystals of their own, at any depth
+	previous := Structures
+	Structures = &StructureRegistry{}
+	defer func() { Structures = previous }()
+
+	gen := NewGenerator(21, DefaultSettings)
+
+	found := make(map[pkg.BlockID]int)
+	for _, coord := range []pkg.Coords{{X: 0, Z: 0}, {X: 5, Z: -2}, {X: -3, Z: 8}, {X: 12, Z: 12}} {
+		column := gen.Generate(coord)
+
+		for x := range pkg.ChunkSize {
+			for y := column.MinY(); y < column.MaxY(); y++ {
+				for z := range pkg.ChunkSize {
+					voxel := column.Get(x, y, z)
+					for _, ore := range Ores.All() {
+						if voxel.Type != ore.Block {
+							continue
+						}
+						found[ore.Block]++
+						if y < ore.MinY || y > ore.MaxY {
+							t.Errorf("%s at y %d, outside [%d, %d]", ore.Name, y, ore.MinY, ore.MaxY)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, ore := range Ores.All() {
+		if ore.Frequency >= 1 && found[ore.Block] == 0 {
+			t.Errorf("no %s was generated", ore.Name)
+		}
+	}
+}
+
+func TestOresDontDependOnTheOrder(t *testing.T) {
+	defer func(ores *OreRegistry) { Ores = ores }(Ores)
+
+	// Long veins in the same range, so they cross
+	stone := Blocks.ID("Stone")
+	coal := OreProperties{Name: "Coal", Block: Blocks.ID("CoalOre"), Host: stone, MinY: -32, MaxY: 0, VeinSize: 60, Frequency: 8}
+	iron := OreProperties{Name: "Iron", Block: Blocks.ID("IronOre"), Host: stone, MinY: -32, MaxY: 0, VeinSize: 60, Frequency: 8}
+
+	veins := func(ores ...OreProperties) map[[3]int]pkg.BlockID {
+		Ores = &OreRegistry{ores: ores}
+		column := NewGenerator(21, DefaultSettings).Generate(pkg.Coords{X: 5, Z: -2})
+		found := make(map[[3]int]pkg.BlockID)
+		for x := range pkg.ChunkSize {
+			for y := column.MinY(); y < column.MaxY(); y++ {
+				for z := range pkg.ChunkSize {
+					if block := column.Get(x, y, z).Type; block == coal.Block || block == iron.Block {
+						found[[3]int{x, y, z}] = block
+					}
+				}
+			}
+		}
+		return found
+	}
+
+	coalOnly := veins(coal)
+	crossed := 0
+	for pos := range veins(iron) {
+		if coalOnly[pos] != 0 {
+			crossed++
+		}
+	}
+	if crossed == 0 {
+		t.Fatal("no coal and iron veins cross in the column, the test checks nothing")
+	}
+
+	before := veins(coal, iron)
+	after := veins(iron, coal)
+	if len(before) != len(after) {
+		t.Fatalf("%d ore voxels before reordering, %d after", len(before), len(after))
+	}
+	for pos, block := range before {
+		if after[pos] != block {
+			t.Fatalf("ore at %v changed when the ores were reordered", pos)
+		}
+	}
+}
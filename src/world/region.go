@@ -0,0 +1,295 @@
+package world
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go-engine/src/pkg"
+)
+
+// Amount of columns per side stored in each region file (32x32 columns)
+const RegionSize = 32
+
+// Each region file starts with a table of (offset, length) entries, one per column,
+// followed by the compressed column records. Saving a column again overwrites its record when
+// the new one fits, otherwise it appends a new record and points the table to it.
+const regionHeaderSize = RegionSize * RegionSize * 8
+
+// Stores columns of chunks on disk, grouped in region files
+type RegionStore struct {
+	Dir   string
+	mutex sync.Mutex          // region files are shared by many columns, only one goroutine touches them at a time
+	kept  map[pkg.Coords]bool // columns whose record has another version, never overwritten
+}
+
+// Bumped whenever a change of the record layout can't be read by the old code. Fields that
+// are added don't need it: gob leaves them empty in older records (see toColumn).
+const columnRecordVersion = 2
+
+// A record of another version can't be read. It isn't overwritten either, so the edits it has
+// aren't lost: the column is generated for the session but never saved.
+var errOtherVersion = errors.New("column record of another format version")
+
+type columnRecord struct {
+	Version   int
+	Sections  []sectionRecord // only the chunks that are not empty
+	HeightMap [pkg.ChunkSize][pkg.ChunkSize]int
+	Biomes    [pkg.ChunkSize][pkg.ChunkSize]string
+	Plants    []pkg.PlantData
+	Trees     []pkg.TreeData
+	TreesFrom uint16
+	Stage     pkg.Stage // 0 in the records written before the stages existed, they were complete
+}
+
+type sectionRecord struct {
+	Y       int // chunk Y
+	Palette []pkg.VoxelData
+	Voxels  []uint16 // palette indices, ordered x → y → z
+}
+
+func NewRegionStore(dir string) *RegionStore {
+	return &RegionStore{Dir: dir}
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+// Returns the path of the region file that contains the column and the column's entry in the table
+func (rs *RegionStore) locate(coord pkg.Coords) (string, int64) {
+	rx := floorDiv(coord.X, RegionSize)
+	rz := floorDiv(coord.Z, RegionSize)
+
+	localX := coord.X - rx*RegionSize
+	localZ := coord.Z - rz*RegionSize
+
+	path := filepath.Join(rs.Dir, fmt.Sprintf("r.%d.%d.region", rx, rz))
+	return path, int64(localX*RegionSize+localZ) * 8
+}
+
+// Loads a column from disk. Returns nil (without error) if the column was never saved.
+func (rs *RegionStore) Load(coord pkg.Coords, settings Settings) (*pkg.Column, error) {
+	path, entry := rs.locate(coord)
+
+	rs.mutex.Lock()
+	data, err := readRegionEntry(path, entry)
+	rs.mutex.Unlock()
+
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var record columnRecord
+	if err := gob.NewDecoder(reader).Decode(&record); err != nil {
+		return nil, err
+	}
+	if record.Version != columnRecordVersion {
+		rs.mutex.Lock()
+		if rs.kept == nil {
+			rs.kept = make(map[pkg.Coords]bool)
+		}
+		rs.kept[coord] = true
+		rs.mutex.Unlock()
+		return nil, fmt.Errorf("%w: version %d, expected %d", errOtherVersion, record.Version, columnRecordVersion)
+	}
+
+	return record.toColumn(coord, settings)
+}
+
+// Writes the column to its region file
+func (rs *RegionStore) Save(coord pkg.Coords, column *pkg.Column) error {
+	var buffer bytes.Buffer
+	writer := zlib.NewWriter(&buffer)
+	if err := gob.NewEncoder(writer).Encode(newColumnRecord(column)); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	path, entry := rs.locate(coord)
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if rs.kept[coord] {
+		return fmt.Errorf("%w: the record of column %v is kept", errOtherVersion, coord)
+	}
+	if err := os.MkdirAll(rs.Dir, 0o755); err != nil {
+		return err
+	}
+	return writeRegionEntry(path, entry, buffer.Bytes())
+}
+
+func readRegionEntry(path string, entry int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var location [8]byte
+	if _, err := file.ReadAt(location[:], entry); err != nil {
+		return nil, err
+	}
+
+	offset := binary.LittleEndian.Uint32(location[0:4])
+	length := binary.LittleEndian.Uint32(location[4:8])
+	if length == 0 {
+		return nil, nil // column not saved yet
+	}
+
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func writeRegionEntry(path string, entry int64, data []byte) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	// New region file → reserve the (empty) table
+	if end < regionHeaderSize {
+		if _, err := file.WriteAt(make([]byte, regionHeaderSize), 0); err != nil {
+			return err
+		}
+		end = regionHeaderSize
+	}
+
+	// The old record is reused when the new one fits in it, so saving the same column
+	// over and over doesn't make the file grow
+	var location [8]byte
+	if _, err := file.ReadAt(location[:], entry); err != nil {
+		return err
+	}
+	offset := int64(binary.LittleEndian.Uint32(location[0:4]))
+	if old := binary.LittleEndian.Uint32(location[4:8]); old == 0 || int(old) < len(data) {
+		offset = end
+	}
+
+	// Offsets are stored in 32 bits
+	if offset > math.MaxUint32 {
+		return fmt.Errorf("region file %s is over 4 GiB", path)
+	}
+
+	if _, err := file.WriteAt(data, offset); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(location[0:4], uint32(offset))
+	binary.LittleEndian.PutUint32(location[4:8], uint32(len(data)))
+	_, err = file.WriteAt(location[:], entry)
+	return err
+}
+
+func newColumnRecord(column *pkg.Column) *columnRecord {
+	record := &columnRecord{
+		Version:   columnRecordVersion,
+		HeightMap: column.HeightMap,
+		Plants:    column.Plants,
+		Trees:     column.Trees,
+		TreesFrom: column.TreesFrom,
+		Stage:     column.Stage,
+	}
+
+	for _, chunk := range column.Sections {
+		if chunk == nil {
+			continue
+		}
+
+		section := sectionRecord{
+			Y:       chunk.Coord.Y,
+			Palette: chunk.Voxels.Palette(),
+			Voxels:  make([]uint16, 0, pkg.ChunkVolume),
+		}
+		for x := 0; x < pkg.ChunkSize; x++ {
+			for y := 0; y < pkg.ChunkSize; y++ {
+				for z := 0; z < pkg.ChunkSize; z++ {
+					section.Voxels = append(section.Voxels, chunk.Voxels.Index(x, y, z))
+				}
+			}
+		}
+		record.Sections = append(record.Sections, section)
+	}
+
+	for x := 0; x < pkg.ChunkSize; x++ {
+		for z := 0; z < pkg.ChunkSize; z++ {
+			record.Biomes[x][z] = column.BiomeMap[x][z].Name
+		}
+	}
+	return record
+}
+
+func (record *columnRecord) toColumn(coord pkg.Coords, settings Settings) (*pkg.Column, error) {
+	column := pkg.NewColumn(coord.X, coord.Z, settings.MinSection(), settings.Sections())
+	column.HeightMap = record.HeightMap
+	column.Plants = record.Plants
+	column.Trees = record.Trees
+	column.TreesFrom = record.TreesFrom
+	column.Stage = record.Stage
+	if column.Stage == 0 {
+		column.Stage = pkg.StageFinal
+	}
+
+	for _, section := range record.Sections {
+		if len(section.Voxels) != pkg.ChunkVolume {
+			return nil, fmt.Errorf("chunk record has %d voxels", len(section.Voxels))
+		}
+
+		i := 0
+		for x := 0; x < pkg.ChunkSize; x++ {
+			for y := 0; y < pkg.ChunkSize; y++ {
+				for z := 0; z < pkg.ChunkSize; z++ {
+					index := int(section.Voxels[i])
+					if index >= len(section.Palette) {
+						return nil, fmt.Errorf("palette index %d out of range", index)
+					}
+					column.Set(x, section.Y*pkg.ChunkSize+y, z, section.Palette[index])
+					i++
+				}
+			}
+		}
+	}
+
+	for x := 0; x < pkg.ChunkSize; x++ {
+		for z := 0; z < pkg.ChunkSize; z++ {
+			if biome, ok := Biomes.Get(record.Biomes[x][z]); ok {
+				column.BiomeMap[x][z] = *biome
+			}
+		}
+	}
+
+	return column, nil
+}
@@ -0,0 +1,177 @@
+package world
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/gob"
+	"os"
+	"testing"
+
+	"go-engine/src/pkg"
+)
+
+// Columns on both sides of the region borders, negative ones included
+var regionCoords = []pkg.Coords{
+	{X: 0, Z: 0}, {X: -1, Z: 0}, {X: 0, Z: -1}, {X: -1, Z: -1},
+	{X: 31, Z: 31}, {X: 32, Z: 32}, {X: -32, Z: -32}, {X: -33, Z: -33}, {X: -33, Z: 40},
+}
+
+func TestRegionRoundTrip(t *testing.T) {
+	store := NewRegionStore(t.TempDir())
+	column := NewGenerator(42, DefaultSettings).Generate(pkg.Coords{X: -1, Z: -1})
+	top := column.MaxY() - 1
+	stone := voxelOf("Stone")
+
+	// Each coordinate gets a marker at its own x, so columns that share an entry are noticed
+	for i, coord := range regionCoords {
+		for x := range pkg.ChunkSize {
+			column.Set(x, top, 0, pkg.VoxelData{})
+		}
+		column.Set(i, top, 0, stone)
+		if err := store.Save(coord, column); err != nil {
+			t.Fatalf("saving %v: %v", coord, err)
+		}
+	}
+
+	for i, coord := range regionCoords {
+		loaded, err := store.Load(coord, DefaultSettings)
+		if err != nil || loaded == nil {
+			t.Fatalf("loading %v: %v", coord, err)
+		}
+		for x := range pkg.ChunkSize {
+			if marked := loaded.Get(x, top, 0) == stone; marked != (x == i) {
+				t.Fatalf("column %v has the marker of another column at x %d", coord, x)
+			}
+		}
+		loaded.Set(i, top, 0, pkg.VoxelData{})
+		column.Set(len(regionCoords)-1, top, 0, pkg.VoxelData{})
+		if loaded.Stage != column.Stage || loaded.HeightMap != column.HeightMap || !sameVoxels(loaded, column) {
+			t.Errorf("column %v changed in the round trip", coord)
+		}
+	}
+
+	if column, err := store.Load(pkg.Coords{X: 5, Z: -70}, DefaultSettings); column != nil || err != nil {
+		t.Errorf("a column that was never saved loaded as %v, %v", column, err)
+	}
+}
+
+func TestRegionReusesRecords(t *testing.T) {
+	store := NewRegionStore(t.TempDir())
+	column := NewGenerator(42, DefaultSettings).Generate(pkg.Coords{X: 3, Z: 4})
+	coord := pkg.Coords{X: 3, Z: 4}
+	path, _ := store.locate(coord)
+
+	if err := store.Save(coord, column); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if err := store.Save(coord, column); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if again, _ := os.Stat(path); again.Size() != info.Size() {
+		t.Errorf("saving the same column again made the region grow from %d to %d bytes", info.Size(), again.Size())
+	}
+}
+
+func TestRegionRejectsOffsetsOver4GiB(t *testing.T) {
+	store := NewRegionStore(t.TempDir())
+	coord := pkg.Coords{X: 1, Z: 1}
+	path, entry := store.locate(coord)
+
+	// Sparse file, it doesn't take the space on disk
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Truncate(5 << 30); err != nil {
+		file.Close()
+		t.Skipf("no sparse files: %v", err)
+	}
+	file.Close()
+
+	if err := writeRegionEntry(path, entry, []byte("record")); err == nil {
+		t.Error("a record was written past 4 GiB")
+	}
+}
+
+func TestRegionBadRecords(t *testing.T) {
+	store := NewRegionStore(t.TempDir())
+	if err := os.MkdirAll(store.Dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(coord pkg.Coords, data []byte) {
+		path, entry := store.locate(coord)
+		if err := writeRegionEntry(path, entry, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encode := func(record columnRecord) []byte {
+		var buffer bytes.Buffer
+		writer := zlib.NewWriter(&buffer)
+		if err := gob.NewEncoder(writer).Encode(record); err != nil {
+			t.Fatal(err)
+		}
+		writer.Close()
+		return buffer.Bytes()
+	}
+
+	// Another version
+	old := pkg.Coords{X: 0, Z: 0}
+	write(old, encode(columnRecord{Version: columnRecordVersion - 1}))
+	if column, err := store.Load(old, DefaultSettings); column != nil || err == nil {
+		t.Error("a record of another version was loaded")
+	}
+	// The column is generated instead, but its edits can't replace the record
+	if err := store.Save(old, NewGenerator(42, DefaultSettings).Generate(old)); err == nil {
+		t.Error("a record of another version was overwritten")
+	}
+	if data, _ := readRegionEntry(store.locate(old)); !bytes.Equal(data, encode(columnRecord{Version: columnRecordVersion - 1})) {
+		t.Error("the record of another version changed")
+	}
+
+	// Written before the stages existed, the column was finished
+	finished := pkg.Coords{X: 4, Z: 0}
+	write(finished, encode(columnRecord{Version: columnRecordVersion}))
+	if column, err := store.Load(finished, DefaultSettings); column == nil || column.Stage != pkg.StageFinal {
+		t.Errorf("a record without a stage loaded as %v (%v)", column, err)
+	}
+
+	// Not zlib
+	corrupt := pkg.Coords{X: 1, Z: 0}
+	write(corrupt, []byte("not a column record"))
+	if column, err := store.Load(corrupt, DefaultSettings); column != nil || err == nil {
+		t.Error("a corrupt record was loaded")
+	}
+
+	// Cut in the middle: the table points past the end of the file
+	truncated := pkg.Coords{X: 2, Z: 0}
+	data := encode(columnRecord{Version: columnRecordVersion})
+	write(truncated, data)
+	path, _ := store.locate(truncated)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-int64(len(data))/2); err != nil {
+		t.Fatal(err)
+	}
+	if column, err := store.Load(truncated, DefaultSettings); column != nil || err == nil {
+		t.Error("a truncated record was loaded")
+	}
+
+	// A palette index out of the palette
+	bad := pkg.Coords{X: 3, Z: 0}
+	write(bad, encode(columnRecord{
+		Version:  columnRecordVersion,
+		Sections: []sectionRecord{{Y: 0, Palette: []pkg.VoxelData{{}}, Voxels: append(make([]uint16, pkg.ChunkVolume-1), 1)}},
+	}))
+	if column, err := store.Load(bad, DefaultSettings); column != nil || err == nil {
+		t.Error("a record with a palette index out of range was loaded")
+	}
+}
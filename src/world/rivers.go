@@ -0,0 +1,100 @@
+package world
+
+import (
+	"go-engine/src/noise"
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	riverWidth  = 0.02 // rivers follow the places where the river noise is close to zero
+	riverDepth  = 4    // depth of the riverbed at the middle of the river
+	valleyWidth = 5.0  // half width of the valley, in river widths
+	bankWidth   = 1.5  // sand and gravel reach this far, in river widths
+
+	// Rivers get up to this many times wider as they get close to the sea
+	riverMouthWidening = 2.5
+)
+
+// River at a terrain column
+type riverSample struct {
+	Level int  // height of the water surface, 0 when there is no river
+	Bed   bool // under the water
+	Bank  bool // on the shore
+}
+
+// Meandering river field. It is warped and independent from the biome cells, so rivers cross biome borders.
+func newRiverNoise(seed int64) noise.Source {
+	base := noise.NewFBM(noise.NewPerlin(noise.DeriveSeed(seed, 0)), noise.DefaultOctaves(2, 1.0/700))
+	return noise.NewWarp(base, noise.DeriveSeed(seed, 1), noise.DefaultOctaves(2, 1.0/150), 60)
+}
+
+// Carves the river valley into the terrain height of a column. Returns the new height and the river there.
+func (g *Generator) carveRiver(position rl.Vector3, x, z, height int) (int, riverSample) {
+	gx := int(position.X) + x
+	gz := int(position.Z) + z
+
+	seaLevel := g.World.WaterLevel()
+	if height <= seaLevel {
+		return height, riverSample{} // the river already reached the sea
+	}
+
+	// Wider close to the sea (low continentalness)
+	continentalness := g.BiomeSelector.Climate(gx, gz).Continentalness
+	width := riverWidth * (1 + (riverMouthWidening-1)*(1-continentalness))
+
+	n := g.Rivers.Noise2D(float64(gx), float64(gz))
+	d := max(n, -n) / width // 0 in the middle of the river, 1 at the water's edge
+	if d >= valleyWidth {
+		return height, riverSample{}
+	}
+
+	// The water follows the large scale shape of the land, so it goes down toward the sea
+	level := int(globalHeight(gx, gz, g.Height)*float64(g.World.Height-16)*0.7) - 2
+	level = max(seaLevel, min(level, height-1))
+
+	river := riverSample{Level: level, Bank: d < bankWidth}
+
+	if d < 1 {
+		river.Bed = true
+		bed := level - int(float64(riverDepth)*(1-d*d)) - 1
+		return min(height, bed), river
+	}
+
+	// Valley slopes rise smoothly from the water to the terrain
+	t := (d - 1) / (valleyWidth - 1)
+	t = t * t * (3 - 2*t) // smoothstep
+	slope := level + int(float64(height-level)*t)
+	return min(height, slope), river
+}
+
+// Covers the riverbed and banks with sand or gravel and fills the river with water
+func placeRiver(column *pkg.Column, position rl.Vector3, x, z int, river riverSample, sand noise.Source) {
+	height := column.HeightMap[x][z]
+
+	if river.Bed || river.Bank {
+		shore := voxelOf("Sand")
+		gx, gz := float64(int(position.X)+x), float64(int(position.Z)+z)
+		if sand.Noise2D(gx, gz) > 0.1 {
+			shore = voxelOf("Gravel")
+		}
+		for y := height - 1; y <= height; y++ {
+			if Blocks.Get(column.Get(x, y, z).Type).IsSolid {
+				column.Set(x, y, z, shore)
+			}
+		}
+	}
+
+	if !river.Bed {
+		return
+	}
+
+	water := voxelOf("Water")
+	for y := river.Level; y > height; y-- {
+		if !Blocks.Get(column.Get(x, y, z).Type).IsReplaceable {
+			break
+		}
+		column.Set(x, y, z, water)
+	}
+}
@@ -0,0 +1,52 @@
+package world
+
+import (
+	"testing"
+
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestRiversCarveValleysAndHoldWater(t *testing.T) {
+	gen := NewGenerator(8, DefaultSettings)
+	seaLevel := gen.World.WaterLevel()
+
+	var riverColumn *pkg.Coords
+	beds := 0
+	for gx := -768; gx < 768; gx += 16 {
+		for gz := -768; gz < 768; gz += 16 {
+			position := rl.NewVector3(float32(gx), 0, float32(gz))
+			height, _ := gen.shapeTerrain(position, 0, 0)
+			carved, river := gen.carveRiver(position, 0, 0, height)
+
+			if carved > height {
+				t.Fatalf("(%d, %d): the river raised the terrain from %d to %d", gx, gz, height, carved)
+			}
+			if !river.Bed {
+				continue
+			}
+			beds++
+			if river.Level < seaLevel || carved >= river.Level {
+				t.Fatalf("(%d, %d): riverbed at %d with the water at %d", gx, gz, carved, river.Level)
+			}
+			if riverColumn == nil && gx%pkg.ChunkSize == 0 && gz%pkg.ChunkSize == 0 {
+				riverColumn = &pkg.Coords{X: gx / pkg.ChunkSize, Z: gz / pkg.ChunkSize}
+			}
+		}
+	}
+
+	if beds == 0 {
+		t.Fatal("no rivers were found")
+	}
+	if riverColumn == nil {
+		t.Skip("no river at a column corner")
+	}
+
+	// The first voxel of the column is in the river, it must be under water
+	column := gen.Generate(*riverColumn)
+	height := column.HeightMap[0][0]
+	if !Blocks.Get(column.Get(0, height+1, 0).Type).IsLiquid {
+		t.Errorf("column %v: no water above the riverbed at %d", *riverColumn, height)
+	}
+}
@@ -0,0 +1,24 @@
+package world
+
+import (
+	"hash/fnv"
+	"math/rand"
+
+	"go-engine/src/noise"
+	"go-engine/src/pkg"
+)
+
+// Returns a random generator that only depends on the world seed and the chunk coordinates,
+// so a chunk comes out the same no matter when, or how many times, it is generated
+func chunkRand(seed int64, coord pkg.Coords) *rand.Rand {
+	h := int64(coord.X*73856093^coord.Y*19349663^coord.Z*83492791) ^ seed
+	return rand.New(rand.NewSource(noise.DeriveSeed(h, 0x636875)))
+}
+
+// Salt for DeriveSeed taken from a name, so things defined in the data files keep their
+// random streams when other entries are added or reordered
+func nameSalt(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,108 @@
+package world
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go-engine/src/pkg"
+)
+
+// Vertical limits of a world. They are chosen when the world is created and saved with it.
+type Settings struct {
+	Height   int    `json:"height"`   // blocks above y = 0
+	Depth    int    `json:"depth"`    // blocks below y = 0
+	Terrain  string `json:"terrain"`  // TerrainHeightmap or TerrainDensity
+	SnowLine int    `json:"snowLine"` // the surface above it is snow in every biome, 0 for the default
+}
+
+// Terrain modes
+const (
+	TerrainHeightmap = "heightmap" // every column is solid up to its height
+	TerrainDensity   = "density"   // a voxel is solid where a 3D density is positive (overhangs, arches, floating rocks)
+)
+
+var DefaultSettings = Settings{Height: 112, Depth: 32, Terrain: TerrainHeightmap}
+
+// Name of the settings file inside the save folder of a world
+const settingsFile = "world.json"
+
+// Both limits must be whole chunks
+func (s Settings) Validate() error {
+	if s.Height < 2*pkg.ChunkSize || s.Height%pkg.ChunkSize != 0 {
+		return fmt.Errorf("world height must be a multiple of %d and at least %d, got %d", pkg.ChunkSize, 2*pkg.ChunkSize, s.Height)
+	}
+	if s.Depth < 0 || s.Depth%pkg.ChunkSize != 0 {
+		return fmt.Errorf("world depth must be a positive multiple of %d, got %d", pkg.ChunkSize, s.Depth)
+	}
+	if s.Terrain != TerrainHeightmap && s.Terrain != TerrainDensity {
+		return fmt.Errorf("unknown terrain mode %q", s.Terrain)
+	}
+	if s.SnowLine < 0 || s.SnowLine > s.Height {
+		return fmt.Errorf("snow line must be between 0 and the world height, got %d", s.SnowLine)
+	}
+	return nil
+}
+
+// Lowest world Y
+func (s Settings) MinY() int {
+	return -s.Depth
+}
+
+// Chunk Y of the lowest chunk of every column
+func (s Settings) MinSection() int {
+	return -s.Depth / pkg.ChunkSize
+}
+
+// Amount of chunks stacked in a column
+func (s Settings) Sections() int {
+	return (s.Height + s.Depth) / pkg.ChunkSize
+}
+
+func (s Settings) WaterLevel() int {
+	return int(float64(s.Height) * pkg.WaterLevelFraction)
+}
+
+// Lowest height of the snow caps
+func (s Settings) SnowLevel() int {
+	if s.SnowLine == 0 {
+		return int(float64(s.Height) * pkg.SnowLineFraction)
+	}
+	return s.SnowLine
+}
+
+func (s Settings) CloudHeight() int {
+	return s.Height - 20
+}
+
+// Reads the settings of a saved world. A world without settings gets the fallback, which is saved for the next time.
+func LoadSettings(dir string, fallback Settings) (Settings, error) {
+	path := filepath.Join(dir, settingsFile)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := fallback.Validate(); err != nil {
+			return fallback, err
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fallback, err
+		}
+		data, _ := json.MarshalIndent(fallback, "", "  ")
+		return fallback, os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		return fallback, err
+	}
+
+	// Worlds saved before the terrain modes existed are heightmap worlds
+	settings := Settings{Terrain: TerrainHeightmap}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fallback, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := settings.Validate(); err != nil {
+		return fallback, fmt.Errorf("%s: %w", path, err)
+	}
+	return settings, nil
+}
@@ -0,0 +1,216 @@
+package world
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Loads and generates columns on a pool of workers that lives as long as the game.
+// The main thread tells it which columns it wants (see ManageChunks) and picks up the finished
+// ones with Completed, so a frame never waits for the workers.
+type Streamer struct {
+	gen     *Generator
+	cache   *ChunkCache
+	mutex   sync.Mutex
+	wake    *sync.Cond              // signals the workers that there are requests or that it closed
+	queue   requestQueue            // waiting requests, the lowest priority first
+	pending map[pkg.Coords]*request // queued or taken by a worker, until the main thread receives the column
+	done    chan *pkg.Column        // finished columns, waiting for the main thread
+	quit    chan struct{}           // closed by Close
+	closed  bool
+	workers sync.WaitGroup
+}
+
+type request struct {
+	coord    pkg.Coords
+	priority float64 // lower is loaded first
+	index    int     // position in the queue, -1 once a worker took it
+	state    pkg.ChunkState
+}
+
+// Min-heap of requests by priority (container/heap)
+type requestQueue []*request
+
+func (q requestQueue) Len() int           { return len(q) }
+func (q requestQueue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q requestQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *requestQueue) Push(x any) {
+	r := x.(*request)
+	r.index = len(*q)
+	*q = append(*q, r)
+}
+
+func (q *requestQueue) Pop() any {
+	old := *q
+	r := old[len(old)-1]
+	old[len(old)-1] = nil
+	r.index = -1
+	*q = old[:len(old)-1]
+	return r
+}
+
+// Starts the workers. Close stops them.
+func NewStreamer(gen *Generator, cache *ChunkCache, workers int) *Streamer {
+	s := &Streamer{
+		gen:     gen,
+		cache:   cache,
+		pending: make(map[pkg.Coords]*request),
+		done:    make(chan *pkg.Column, 4*workers),
+		quit:    make(chan struct{}),
+	}
+	s.wake = sync.NewCond(&s.mutex)
+
+	for range workers {
+		s.workers.Add(1)
+		go s.work()
+	}
+	return s
+}
+
+func (s *Streamer) work() {
+	defer s.workers.Done()
+
+	for {
+		s.mutex.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.wake.Wait()
+		}
+		if s.closed {
+			s.mutex.Unlock()
+			return
+		}
+		r := heap.Pop(&s.queue).(*request)
+		s.cache.Events.move(r.coord, nil, &r.state, pkg.ChunkGenerating)
+		s.mutex.Unlock()
+
+		column := s.cache.loadColumn(s.gen, r.coord)
+
+		// Waits for room in the channel, unless the game is closing
+		select {
+		case s.done <- column:
+		case <-s.quit:
+			s.cache.discard(chunksOf(column)...)
+			return
+		}
+	}
+}
+
+// Replaces the wanted columns (coordinate → priority). Queued requests that are not wanted
+// anymore are cancelled, the others are reordered. Columns a worker already took still finish.
+// Requests have the first states of a chunk: requested, generating (a worker took it) and
+// generated (the main thread received it), or unloading when they are cancelled.
+func (s *Streamer) Request(wanted map[pkg.Coords]float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Cancels the requests of the columns the player moved away from
+	kept := s.queue[:0]
+	for _, r := range s.queue {
+		priority, ok := wanted[r.coord]
+		if !ok {
+			r.index = -1
+			delete(s.pending, r.coord)
+			s.cache.Events.move(r.coord, nil, &r.state, pkg.ChunkUnloading)
+			continue
+		}
+		r.priority = priority
+		r.index = len(kept)
+		kept = append(kept, r)
+	}
+	for i := len(kept); i < len(s.queue); i++ {
+		s.queue[i] = nil
+	}
+	s.queue = kept
+
+	for coord, priority := range wanted {
+		if _, ok := s.pending[coord]; !ok {
+			r := &request{coord: coord, priority: priority, index: len(s.queue)}
+			s.cache.Events.move(coord, nil, &r.state, pkg.ChunkRequested)
+			s.queue = append(s.queue, r)
+			s.pending[coord] = r
+		}
+	}
+	heap.Init(&s.queue)
+
+	if len(s.queue) > 0 {
+		s.wake.Broadcast()
+	}
+}
+
+// Tells if a column was requested and hasn't been received yet
+func (s *Streamer) Pending(coord pkg.Coords) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.pending[coord]
+	return ok
+}
+
+// Finished columns, without waiting for the ones that are still being generated
+func (s *Streamer) Completed() []*pkg.Column {
+	var columns []*pkg.Column
+	for {
+		select {
+		case column := <-s.done:
+			coord := pkg.Coords{X: column.X, Z: column.Z}
+			s.mutex.Lock()
+			if r, ok := s.pending[coord]; ok {
+				s.cache.Events.move(coord, nil, &r.state, pkg.ChunkGenerated)
+				delete(s.pending, coord)
+			}
+			s.mutex.Unlock()
+			columns = append(columns, column)
+		default:
+			return columns
+		}
+	}
+}
+
+// Stops the workers. The columns they were generating, and the finished ones the main thread
+// didn't pick up, are discarded; the requests that are left are cancelled.
+func (s *Streamer) Close() {
+	s.mutex.Lock()
+	s.closed = true
+	s.wake.Broadcast()
+	s.mutex.Unlock()
+
+	close(s.quit)
+	s.workers.Wait()
+
+	// The workers are stopped, nothing is sent anymore
+	for len(s.done) > 0 {
+		s.cache.discard(chunksOf(<-s.done)...)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for coord, r := range s.pending {
+		s.cache.Events.move(coord, nil, &r.state, pkg.ChunkUnloading)
+	}
+	clear(s.pending)
+	s.queue = nil
+}
+
+// How soon a column should be loaded: its distance to the player, halved right in front
+// of the camera and made 1.5 times longer right behind it
+func viewPriority(coord, playerCoord pkg.Coords, forward rl.Vector3) float64 {
+	dx, dz := float64(coord.X-playerCoord.X), float64(coord.Z-playerCoord.Z)
+	distance := math.Hypot(dx, dz)
+
+	length := math.Hypot(float64(forward.X), float64(forward.Z))
+	if distance == 0 || length == 0 {
+		return distance
+	}
+
+	facing := (dx*float64(forward.X) + dz*float64(forward.Z)) / (distance * length)
+	return distance * (1 - 0.5*facing)
+}
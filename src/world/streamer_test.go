@@ -0,0 +1,89 @@
+package world
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestViewPriority(t *testing.T) {
+	player := pkg.Coords{}
+	forward := rl.NewVector3(1, -0.3, 0)
+
+	front := viewPriority(pkg.Coords{X: 3}, player, forward)
+	side := viewPriority(pkg.Coords{Z: 3}, player, forward)
+	behind := viewPriority(pkg.Coords{X: -3}, player, forward)
+	if !(front < side && side < behind) {
+		t.Errorf("priorities in front %v, to the side %v, behind %v", front, side, behind)
+	}
+	if near, far := viewPriority(pkg.Coords{X: -1}, player, forward), viewPriority(pkg.Coords{X: 4}, player, forward); near >= far {
+		t.Errorf("a column right behind (%v) comes after one far in front (%v)", near, far)
+	}
+}
+
+func TestStreamerQueue(t *testing.T) {
+	// Without workers the requests stay in the queue
+	s := NewStreamer(NewGenerator(1, DefaultSettings), NewChunkCache(), 0)
+	defer s.Close()
+
+	s.Request(map[pkg.Coords]float64{{X: 1}: 3, {X: 2}: 1, {X: 3}: 2, {X: 4}: 5})
+
+	// The player moved: one request is cancelled, another one becomes urgent
+	s.Request(map[pkg.Coords]float64{{X: 1}: 3, {X: 2}: 1, {X: 4}: 0})
+	if s.Pending(pkg.Coords{X: 3}) {
+		t.Error("a request that is not wanted anymore is still pending")
+	}
+
+	var order []int
+	for s.queue.Len() > 0 {
+		order = append(order, heap.Pop(&s.queue).(*request).coord.X)
+	}
+	if len(order) != 3 || order[0] != 4 || order[1] != 2 || order[2] != 1 {
+		t.Errorf("columns taken in the order %v", order)
+	}
+}
+
+func TestManageChunksStreams(t *testing.T) {
+	defer func(distance int) { pkg.ChunkDistance = distance }(pkg.ChunkDistance)
+	pkg.ChunkDistance = 1
+
+	cache := NewChunkCache()
+	s := NewStreamer(NewGenerator(42, DefaultSettings), cache, 4)
+	defer s.Close()
+
+	player := rl.NewVector3(8, 60, 8)
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		start := time.Now()
+		ManageChunks(s, player, rl.NewVector3(0, 0, 1))
+		if frame := time.Since(start); frame > time.Second {
+			t.Errorf("a frame took %v", frame)
+		}
+
+		visible := circle(pkg.Coords{}, RadiiFor(pkg.ChunkDistance).Render)
+		cache.CacheMutex.RLock()
+		finished := 0
+		for _, coord := range visible {
+			if column, ok := cache.Columns[coord]; ok && column.Stage == pkg.StageFinal {
+				finished++
+			}
+		}
+		cache.CacheMutex.RUnlock()
+
+		if finished == len(visible) {
+			break // every visible column
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d columns were finished", finished)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(cache.Active) == 0 {
+		t.Error("no chunks are active")
+	}
+}
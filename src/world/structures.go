@@ -0,0 +1,383 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"go-engine/assets"
+	"go-engine/src/noise"
+	"go-engine/src/pkg"
+	"go-engine/src/vox"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Every structure of the game, loaded from assets/data/structures
+var Structures = mustLoadDefaultStructures()
+
+// A block of voxels that can be stamped into the world
+type Template struct {
+	Name   string
+	Size   [3]int // x, y, z
+	Anchor [3]int // voxel of the template that goes on the placement position
+	voxels []pkg.VoxelData
+	filled []bool // false where the template leaves the world untouched
+}
+
+func NewTemplate(name string, size [3]int) *Template {
+	volume := size[0] * size[1] * size[2]
+	return &Template{
+		Name:   name,
+		Size:   size,
+		voxels: make([]pkg.VoxelData, volume),
+		filled: make([]bool, volume),
+	}
+}
+
+// Builds a template from a model of a MagicaVoxel file. Every voxel becomes the given block,
+// painted with its color in the model. The anchor is the bottom center.
+func NewTemplateFromVox(name string, file *vox.File, model int, block pkg.BlockID) (*Template, error) {
+	if model < 0 || model >= len(file.Models) {
+		return nil, fmt.Errorf("%s has no model %d", name, model)
+	}
+	m := file.Models[model]
+
+	// z is up in MagicaVoxel
+	template := NewTemplate(name, [3]int{m.Size[0], m.Size[2], m.Size[1]})
+	template.Anchor = [3]int{m.Size[0] / 2, 0, m.Size[1] / 2}
+
+	for _, v := range m.Voxels {
+		c := file.Color(v.Color)
+		template.Set(int(v.X), int(v.Z), int(v.Y), pkg.VoxelData{Type: block, Color: rl.NewColor(c.R, c.G, c.B, c.A)})
+	}
+	return template, nil
+}
+
+func (t *Template) index(x, y, z int) int {
+	return (x*t.Size[1]+y)*t.Size[2] + z
+}
+
+// Returns the voxel at a position of the template, and false if the template leaves it untouched
+func (t *Template) Get(x, y, z int) (pkg.VoxelData, bool) {
+	i := t.index(x, y, z)
+	return t.voxels[i], t.filled[i]
+}
+
+func (t *Template) Set(x, y, z int, voxel pkg.VoxelData) {
+	i := t.index(x, y, z)
+	t.voxels[i] = voxel
+	t.filled[i] = true
+}
+
+// Where a structure can be placed
+type PlacementRules struct {
+	On         string   `json:"on"`         // "surface" or "underground"
+	Biomes     []string `json:"biomes"`     // biomes of the anchor, empty accepts any
+	Spacing    int      `json:"spacing"`    // size (in blocks) of the grid cells, each cell gets at most one structure
+	Chance     float64  `json:"chance"`     // of a cell getting the structure
+	Depth      [2]int   `json:"depth"`      // underground: [min, max] blocks below the surface
+	Sink       int      `json:"sink"`       // surface: blocks the structure goes into the ground
+	Foundation string   `json:"foundation"` // surface: block that fills the gap between the structure and the ground
+	Rotate     bool     `json:"rotate"`     // random rotation of 0, 90, 180 or 270 degrees
+	Mirror     bool     `json:"mirror"`     // random mirroring along x
+}
+
+type Structure struct {
+	Template   *Template
+	Rules      PlacementRules
+	foundation pkg.BlockID
+}
+
+// A structure placed in the world
+type Placement struct {
+	Structure *Structure
+	Position  pkg.Coords // world position of the anchor
+	Rotation  int        // quarter turns
+	Mirror    bool
+}
+
+// Structure definition as it is written in the data files
+type structureDefinition struct {
+	Name      string            `json:"name"`
+	Palette   map[string]string `json:"palette"` // character → block name, "." leaves the world untouched
+	Layers    [][]string        `json:"layers"`  // bottom to top, each layer has rows along z made of characters along x
+	Anchor    [3]int            `json:"anchor"`
+	Placement PlacementRules    `json:"placement"`
+
+	// Instead of layers, a MagicaVoxel model (path in the same file system) made of this block
+	Model string `json:"model"`
+	Block string `json:"block"`
+}
+
+type StructureRegistry struct {
+	structures []*Structure // sorted by file name, which keeps the generation deterministic
+}
+
+func mustLoadDefaultStructures() *StructureRegistry {
+	registry, err := LoadStructureRegistry(assets.Data, "data/structures")
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// Loads every .json structure of a folder. The blocks they use must already be in Blocks.
+func LoadStructureRegistry(fsys fs.FS, dir string) (*StructureRegistry, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+
+	registry := &StructureRegistry{}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		var def structureDefinition
+		if err := json.Unmarshal(data, &def); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		structure, err := def.toStructure(fsys)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		registry.structures = append(registry.structures, structure)
+	}
+	return registry, nil
+}
+
+func (def *structureDefinition) toStructure(fsys fs.FS) (*Structure, error) {
+	if def.Model != "" {
+		return def.modelStructure(fsys)
+	}
+	if len(def.Layers) == 0 || len(def.Layers[0]) == 0 {
+		return nil, fmt.Errorf("structure %q has no layers", def.Name)
+	}
+
+	palette := make(map[rune]pkg.VoxelData)
+	for char, name := range def.Palette {
+		id, ok := Blocks.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("structure %q uses unknown block %q", def.Name, name)
+		}
+		palette[[]rune(char)[0]] = pkg.VoxelData{Type: id}
+	}
+
+	size := [3]int{len([]rune(def.Layers[0][0])), len(def.Layers), len(def.Layers[0])}
+	template := NewTemplate(def.Name, size)
+	template.Anchor = def.Anchor
+
+	for y, layer := range def.Layers {
+		if len(layer) != size[2] {
+			return nil, fmt.Errorf("structure %q: layer %d has %d rows, expected %d", def.Name, y, len(layer), size[2])
+		}
+		for z, row := range layer {
+			chars := []rune(row)
+			if len(chars) != size[0] {
+				return nil, fmt.Errorf("structure %q: row %q has %d characters, expected %d", def.Name, row, len(chars), size[0])
+			}
+			for x, char := range chars {
+				if char == '.' {
+					continue
+				}
+				voxel, ok := palette[char]
+				if !ok {
+					return nil, fmt.Errorf("structure %q: %q is not in the palette", def.Name, char)
+				}
+				template.Set(x, y, z, voxel)
+			}
+		}
+	}
+
+	return NewStructure(template, def.Placement)
+}
+
+func (def *structureDefinition) modelStructure(fsys fs.FS) (*Structure, error) {
+	block, ok := Blocks.Lookup(def.Block)
+	if !ok {
+		return nil, fmt.Errorf("structure %q uses unknown block %q", def.Name, def.Block)
+	}
+
+	file, err := vox.Load(fsys, def.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := NewTemplateFromVox(def.Name, file, 0, block)
+	if err != nil {
+		return nil, err
+	}
+	return NewStructure(template, def.Placement)
+}
+
+// Checks the rules and builds a structure from a template (used by the data files and by imported models)
+func NewStructure(template *Template, rules PlacementRules) (*Structure, error) {
+	for i, anchor := range template.Anchor {
+		if anchor < 0 || anchor >= template.Size[i] {
+			return nil, fmt.Errorf("structure %q: anchor %v is outside the template", template.Name, template.Anchor)
+		}
+	}
+	if rules.On != "surface" && rules.On != "underground" {
+		return nil, fmt.Errorf("structure %q: unknown placement %q", template.Name, rules.On)
+	}
+	if rules.On == "underground" && (rules.Depth[0] < 1 || rules.Depth[0] > rules.Depth[1]) {
+		return nil, fmt.Errorf("structure %q: depth %v must be [min, max] blocks below the surface, at least 1", template.Name, rules.Depth)
+	}
+	if rules.Spacing < max(template.Size[0], template.Size[2]) {
+		return nil, fmt.Errorf("structure %q: spacing %d is smaller than the structure", template.Name, rules.Spacing)
+	}
+	for _, name := range rules.Biomes {
+		if _, ok := Biomes.Get(name); !ok {
+			return nil, fmt.Errorf("structure %q: unknown biome %q", template.Name, name)
+		}
+	}
+
+	structure := &Structure{Template: template, Rules: rules}
+	if rules.Foundation != "" {
+		id, ok := Blocks.Lookup(rules.Foundation)
+		if !ok {
+			return nil, fmt.Errorf("structure %q: unknown foundation block %q", template.Name, rules.Foundation)
+		}
+		structure.foundation = id
+	}
+	return structure, nil
+}
+
+func (r *StructureRegistry) All() []*Structure {
+	return r.structures
+}
+
+// Adds a structure (used for structures that don't come from the data files, like imported models)
+func (r *StructureRegistry) Add(structure *Structure) {
+	r.structures = append(r.structures, structure)
+}
+
+func (r *StructureRegistry) Get(name string) (*Structure, bool) {
+	for _, structure := range r.structures {
+		if strings.EqualFold(structure.Template.Name, name) {
+			return structure, true
+		}
+	}
+	return nil, false
+}
+
+// Moves a template position to its offset from the anchor in the world, after mirroring and rotating
+func (p *Placement) offset(x, z int) (int, int) {
+	template := p.Structure.Template
+	dx, dz := x-template.Anchor[0], z-template.Anchor[2]
+	if p.Mirror {
+		dx = -dx
+	}
+	for range p.Rotation {
+		dx, dz = -dz, dx
+	}
+	return dx, dz
+}
+
+// Decides the structure of a grid cell. It only depends on the seed and the cell,
+// so every column that the structure touches finds the same placement. The name salts the seed,
+// so adding or removing a structure file doesn't move the others.
+func (g *Generator) structureAt(structure *Structure, cellX, cellZ int) *Placement {
+	rules := structure.Rules
+	rng := chunkRand(noise.DeriveSeed(g.Seed, nameSalt(structure.Template.Name)), pkg.Coords{X: cellX, Z: cellZ})
+
+	if rng.Float64() >= rules.Chance {
+		return nil
+	}
+
+	gx := cellX*rules.Spacing + rng.Intn(rules.Spacing)
+	gz := cellZ*rules.Spacing + rng.Intn(rules.Spacing)
+
+	placement := &Placement{Structure: structure}
+	if rules.Rotate {
+		placement.Rotation = rng.Intn(4)
+	}
+	if rules.Mirror {
+		placement.Mirror = rng.Intn(2) == 1
+	}
+
+	// The terrain shape is a pure function of the position, unlike the voxels of a neighbor
+	// (in density worlds it is an estimate of the surface)
+	origin := rl.NewVector3(float32(gx), 0, float32(gz))
+	height, biome := g.shapeTerrain(origin, 0, 0)
+	height, river := g.carveRiver(origin, 0, 0, height)
+
+	if len(rules.Biomes) > 0 && !slices.Contains(rules.Biomes, biome.Name) {
+		return nil
+	}
+
+	y := height + 1 - rules.Sink
+	if rules.On == "underground" {
+		y = height - rules.Depth[0] - rng.Intn(rules.Depth[1]-rules.Depth[0]+1)
+	} else if height <= g.World.WaterLevel() || river.Bed {
+		return nil // no buildings under water
+	}
+
+	// The whole structure must fit in the world
+	template := structure.Template
+	if y-template.Anchor[1] <= g.World.MinY() || y-template.Anchor[1]+template.Size[1] >= g.World.Height {
+		return nil
+	}
+
+	placement.Position = pkg.Coords{X: gx, Y: y, Z: gz}
+	return placement
+}
+
+// Stamps the parts of every structure that fall inside the column
+func (g *Generator) placeStructures(column *pkg.Column, coord pkg.Coords) {
+	x0, z0 := coord.X*pkg.ChunkSize, coord.Z*pkg.ChunkSize
+
+	for _, structure := range Structures.All() {
+		spacing := structure.Rules.Spacing
+		// farthest a voxel can be from the anchor, in any rotation
+		reach := max(structure.Template.Size[0], structure.Template.Size[2])
+
+		for cellX := floorDiv(x0-reach, spacing); cellX <= floorDiv(x0+pkg.ChunkSize+reach, spacing); cellX++ {
+			for cellZ := floorDiv(z0-reach, spacing); cellZ <= floorDiv(z0+pkg.ChunkSize+reach, spacing); cellZ++ {
+				if placement := g.structureAt(structure, cellX, cellZ); placement != nil {
+					placement.stamp(column, x0, z0)
+				}
+			}
+		}
+	}
+}
+
+func (p *Placement) stamp(column *pkg.Column, x0, z0 int) {
+	template := p.Structure.Template
+	bottom := p.Position.Y - template.Anchor[1]
+
+	for x := range template.Size[0] {
+		for z := range template.Size[2] {
+			dx, dz := p.offset(x, z)
+			localX := p.Position.X + dx - x0
+			localZ := p.Position.Z + dz - z0
+			if localX < 0 || localX >= pkg.ChunkSize || localZ < 0 || localZ >= pkg.ChunkSize {
+				continue // another column places this part
+			}
+
+			for y := range template.Size[1] {
+				if voxel, ok := template.Get(x, y, z); ok {
+					column.Set(localX, bottom+y, localZ, voxel)
+				}
+			}
+
+			// Fills the gap under the structure, the ground below is in this same column
+			if p.Structure.foundation != 0 {
+				if _, ok := template.Get(x, 0, z); !ok {
+					continue
+				}
+				for y := bottom - 1; y > column.MinY() && !Blocks.Get(column.Get(localX, y, localZ).Type).IsSolid; y-- {
+					column.Set(localX, y, localZ, pkg.VoxelData{Type: p.Structure.foundation})
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package world
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"go-engine/src/pkg"
+	"go-engine/src/vox"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestPlacementRotation(t *testing.T) {
+	structure, ok := Structures.Get("Hut")
+	if !ok {
+		t.Fatal("no Hut structure")
+	}
+	template := structure.Template
+
+	for _, mirror := range []bool{false, true} {
+		for rotation := range 4 {
+			p := &Placement{Structure: structure, Rotation: rotation, Mirror: mirror}
+			if dx, dz := p.offset(template.Anchor[0], template.Anchor[2]); dx != 0 || dz != 0 {
+				t.Errorf("rotation %d mirror %v moves the anchor to %d, %d", rotation, mirror, dx, dz)
+			}
+
+			// Every voxel of the footprint must land on a different place
+			seen := make(map[[2]int]bool)
+			for x := range template.Size[0] {
+				for z := range template.Size[2] {
+					dx, dz := p.offset(x, z)
+					if seen[[2]int{dx, dz}] {
+						t.Fatalf("rotation %d mirror %v places two voxels at %d, %d", rotation, mirror, dx, dz)
+					}
+					seen[[2]int{dx, dz}] = true
+				}
+			}
+		}
+	}
+}
+
+// Each column is generated on its own, the parts of a structure must still line up
+func TestStructuresAcrossColumns(t *testing.T) {
+	gen := NewGenerator(5, DefaultSettings)
+	structure, ok := Structures.Get("Dungeon")
+	if !ok {
+		t.Fatal("no Dungeon structure")
+	}
+	template := structure.Template
+
+	// Looks for a dungeon on a column border
+	crosses := func(p *Placement) bool {
+		dx, dz := p.offset(0, 0)
+		ex, ez := p.offset(template.Size[0]-1, template.Size[2]-1)
+		return floorDiv(p.Position.X+dx, pkg.ChunkSize) != floorDiv(p.Position.X+ex, pkg.ChunkSize) ||
+			floorDiv(p.Position.Z+dz, pkg.ChunkSize) != floorDiv(p.Position.Z+ez, pkg.ChunkSize)
+	}
+	var placement *Placement
+	for cell := 0; cell < 400; cell++ {
+		if p := gen.structureAt(structure, cell%20, cell/20); p != nil && crosses(p) {
+			placement = p
+			break
+		}
+	}
+	if placement == nil {
+		t.Fatal("no dungeon was placed on a column border")
+	}
+
+	bottom := placement.Position.Y - template.Anchor[1]
+	columns := make(map[pkg.Coords]*pkg.Column)
+
+	for x := range template.Size[0] {
+		for z := range template.Size[2] {
+			dx, dz := placement.offset(x, z)
+			gx, gz := placement.Position.X+dx, placement.Position.Z+dz
+			coord := pkg.Coords{X: floorDiv(gx, pkg.ChunkSize), Z: floorDiv(gz, pkg.ChunkSize)}
+
+			column, ok := columns[coord]
+			if !ok {
+				column = gen.Generate(coord)
+				columns[coord] = column
+			}
+
+			for y := range template.Size[1] {
+				want, ok := template.Get(x, y, z)
+				if !ok {
+					continue
+				}
+				got := column.Get(gx-coord.X*pkg.ChunkSize, bottom+y, gz-coord.Z*pkg.ChunkSize)
+				if got.Type != want.Type {
+					t.Fatalf("voxel at %d, %d, %d is %s, expected %s", gx, bottom+y, gz, Blocks.Get(got.Type).Name, Blocks.Get(want.Type).Name)
+				}
+			}
+		}
+	}
+}
+
+func TestAddingAStructureDoesntMoveTheOthers(t *testing.T) {
+	gen := NewGenerator(5, DefaultSettings)
+	structure, ok := Structures.Get("Dungeon")
+	if !ok {
+		t.Fatal("no Dungeon structure")
+	}
+
+	// Columns with the anchor of a dungeon
+	var coords []pkg.Coords
+	for cell := 0; cell < 400 && len(coords) < 3; cell++ {
+		if p := gen.structureAt(structure, cell%20, cell/20); p != nil {
+			coords = append(coords, pkg.Coords{X: floorDiv(p.Position.X, pkg.ChunkSize), Z: floorDiv(p.Position.Z, pkg.ChunkSize)})
+		}
+	}
+	if len(coords) == 0 {
+		t.Fatal("no dungeon was placed")
+	}
+	var before []*pkg.Column
+	for _, coord := range coords {
+		before = append(before, gen.Generate(coord))
+	}
+
+	// A structure whose file sorts before the others. It is never placed, so nothing may change.
+	fsys := dataFS(t, map[string]string{"data/structures/aaa.json": `{"name": "Pillar", "palette": {"#": "Stone"}, "layers": [["#"]],
+		"placement": {"on": "surface", "spacing": 8, "chance": 0}}`})
+	registry, err := LoadStructureRegistry(fsys, "data/structures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry.All()[0].Template.Name != "Pillar" {
+		t.Fatal("the new structure isn't the first of the registry")
+	}
+	previous := Structures
+	Structures = registry
+	defer func() { Structures = previous }()
+
+	for i, coord := range coords {
+		if !sameVoxels(gen.Generate(coord), before[i]) {
+			t.Errorf("column %v changed when a structure was added", coord)
+		}
+	}
+}
+
+func TestStructureErrors(t *testing.T) {
+	files := map[string]string{
+		"unknown block":   `{"name": "A", "palette": {"#": "Marble"}, "layers": [["#"]], "placement": {"on": "surface", "spacing": 8}}`,
+		"not in palette":  `{"name": "A", "palette": {"#": "Stone"}, "layers": [["#X"]], "placement": {"on": "surface", "spacing": 8}}`,
+		"uneven rows":     `{"name": "A", "palette": {"#": "Stone"}, "layers": [["##", "#"]], "placement": {"on": "surface", "spacing": 8}}`,
+		"anchor outside":  `{"name": "A", "palette": {"#": "Stone"}, "layers": [["#"]], "anchor": [1, 0, 0], "placement": {"on": "surface", "spacing": 8}}`,
+		"small spacing":   `{"name": "A", "palette": {"#": "Stone"}, "layers": [["###"]], "placement": {"on": "surface", "spacing": 2}}`,
+		"unknown biome":   `{"name": "A", "palette": {"#": "Stone"}, "layers": [["#"]], "placement": {"on": "surface", "spacing": 8, "biomes": ["Moon"]}}`,
+		"unknown surface": `{"name": "A", "palette": {"#": "Stone"}, "layers": [["#"]], "placement": {"on": "sky", "spacing": 8}}`,
+		"missing model":   `{"name": "A", "model": "missing.vox", "block": "Stone", "placement": {"on": "surface", "spacing": 8}}`,
+		"reversed depth":  `{"name": "A", "palette": {"#": "Stone"}, "layers": [["#"]], "placement": {"on": "underground", "spacing": 8, "depth": [40, 16]}}`,
+		"no depth":        `{"name": "A", "palette": {"#": "Stone"}, "layers": [["#"]], "placement": {"on": "underground", "spacing": 8, "depth": [0, 0]}}`,
+		"missing depth":   `{"name": "A", "palette": {"#": "Stone"}, "layers": [["#"]], "placement": {"on": "underground", "spacing": 8}}`,
+	}
+
+	for name, data := range files {
+		fsys := fstest.MapFS{"structures/a.json": {Data: []byte(data)}}
+		if _, err := LoadStructureRegistry(fsys, "structures"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTemplateFromVox(t *testing.T) {
+	file, err := vox.Load(os.DirFS("../../assets"), "plants/plant_1.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := file.Models[0]
+
+	template, err := NewTemplateFromVox("plant", file, 0, Blocks.ID("Leaves"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filled := 0
+	for x := range template.Size[0] {
+		for y := range template.Size[1] {
+			for z := range template.Size[2] {
+				if _, ok := template.Get(x, y, z); ok {
+					filled++
+				}
+			}
+		}
+	}
+	if filled != len(model.Voxels) {
+		t.Errorf("%d voxels in the template, the model has %d", filled, len(model.Voxels))
+	}
+
+	v := model.Voxels[0]
+	voxel, _ := template.Get(int(v.X), int(v.Z), int(v.Y))
+	c := file.Color(v.Color)
+	if voxel.Type != Blocks.ID("Leaves") || voxel.Color != rl.NewColor(c.R, c.G, c.B, c.A) {
+		t.Errorf("voxel %+v, expected a leaves block colored %v", voxel, c)
+	}
+
+	if _, err := NewTemplateFromVox("plant", file, 1, Blocks.ID("Leaves")); err == nil {
+		t.Error("expected an error for a missing model")
+	}
+
+	// Structures can use a model instead of layers
+	model1, err := fs.ReadFile(os.DirFS("../../assets"), "plants/plant_1.vox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"structures/bush.json": {Data: []byte(`{"name": "Bush", "model": "plants/plant_1.vox", "block": "Leaves", "placement": {"on": "surface", "spacing": 32}}`)},
+		"plants/plant_1.vox":   {Data: model1},
+	}
+
+	registry, err := LoadStructureRegistry(fsys, "structures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bush, ok := registry.Get("Bush"); !ok || bush.Template.Size != template.Size {
+		t.Errorf("the model structure was not loaded like its template")
+	}
+}
@@ -3,26 +3,24 @@ package world
 import (
 	"go-engine/src/pkg"
 	"math"
-	"math/rand"
 
-	"github.com/aquilax/go-perlin"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
 //	Intersting model that looks like kelp
 //return "F=F[FA(2)L]F[+A(3)L]F[−A(3)L]F[/A(2)L]F[\\A(2)L]A(3)"
 
-func shapeTerrain(worley *WorleyNoise, biomeSel *BiomeSelector, position rl.Vector3, x, z int, p1, p2, p3 *perlin.Perlin) (int, pkg.BiomeProperties) {
+func (g *Generator) shapeTerrain(position rl.Vector3, x, z int) (int, pkg.BiomeProperties) {
 	gx := int(position.X) + x
 	gz := int(position.Z) + z
 
-	d1, d2, nearestX, nearestZ, secondX, secondZ := worley.Evaluate(gx, gz)
+	d1, d2, nearestX, nearestZ, secondX, secondZ := g.Worley.Evaluate(gx, gz)
 
-	nearestBiome := biomeSel.biomeForCell(nearestX, nearestZ)
-	secondBiome := biomeSel.biomeForCell(secondX, secondZ)
+	nearestBiome := g.BiomeSelector.biomeForCell(nearestX, nearestZ)
+	secondBiome := g.BiomeSelector.biomeForCell(secondX, secondZ)
 
 	// Global Height (for shaping overall terrain)
-	hGlobal := globalHeight(gx, gz, p1) * float64(pkg.WorldHeight-16)
+	hGlobal := globalHeight(gx, gz, g.Height) * float64(g.World.Height-16)
 
 	blend := d1 / (d1 + d2)
 	blend = blend * blend * (3 - 2*blend) // smoothstep
@@ -30,13 +28,13 @@ func shapeTerrain(worley *WorleyNoise, biomeSel *BiomeSelector, position rl.Vect
 	// Terrain variation by biome
 	var modA, modB float64
 
-	modA = nearestBiome.Modifier(gx, gz, p2, p3)
+	modA = g.biomeModifier(nearestBiome, gx, gz)
 
 	//	If the same biome is generated by it's side, do not recalculate the terrain
 	if nearestBiome == secondBiome {
 		modB = modA
 	} else {
-		modB = secondBiome.Modifier(gx, gz, p2, p3)
+		modB = g.biomeModifier(secondBiome, gx, gz)
 	}
 
 	combinedMod := modA*(1-blend) + modB*blend
@@ -49,156 +47,181 @@ func shapeTerrain(worley *WorleyNoise, biomeSel *BiomeSelector, position rl.Vect
 		dominantBiome = secondBiome
 	}
 
+	// Close to the sea the land goes down to the sea floor
+	height, dominantBiome = g.shapeSea(gx, gz, height, dominantBiome)
+
 	return int(height), *dominantBiome
 }
 
-func GenerateChunk(worley *WorleyNoise, biomeSel *BiomeSelector, position rl.Vector3, p1, p2, p3 *perlin.Perlin, chunkCache *ChunkCache, oldPlants []pkg.PlantData, reusePlants bool, oldTrees []pkg.TreeData, reuseTrees bool) *pkg.Chunk {
-	chunk := &pkg.Chunk{
-		Plants: []pkg.PlantData{},
-		Trees:  []pkg.TreeData{},
-	}
-
-	// Registers the chunk in Active before generating caves
-	coord := ToChunkCoord(position)
-	chunkCache.CacheMutex.Lock()
-	chunkCache.Active[coord] = chunk
-	chunkCache.CacheMutex.Unlock()
+// Terrain stage: everything that only depends on the column itself
+func (g *Generator) generateTerrain(coord pkg.Coords) *pkg.Column {
+	column := pkg.NewColumn(coord.X, coord.Z, g.World.MinSection(), g.World.Sections())
 
-	waterLevel := int(float64(pkg.WorldHeight)*pkg.WaterLevelFraction) - 1
+	position := ChunkOrigin(coord)
+	waterLevel := g.World.WaterLevel() - 1
 
 	for x := 0; x < pkg.ChunkSize; x++ {
 		for z := 0; z < pkg.ChunkSize; z++ {
-			height, biome := shapeTerrain(worley, biomeSel, position, x, z, p1, p2, p3)
-
-			chunk.HeightMap[x][z] = height
-			chunk.BiomeMap[x][z] = biome
-
-			for y := 0; y < pkg.WorldHeight; y++ {
-				isSolid := y <= height
-				if isSolid {
-					chunk.Voxels[x][y][z] = pkg.VoxelData{Type: biome.UndergroundBlock}
-					if y == height && y > waterLevel {
-						chunk.Voxels[x][y][z] = pkg.VoxelData{
-							Type:  biome.SurfaceBlock,
-							Color: biome.GrassColor,
-						}
-					} else if y <= height-5 {
-						chunk.Voxels[x][y][z] = pkg.VoxelData{Type: "Stone"}
-					}
-				} else {
-					chunk.Voxels[x][y][z] = pkg.VoxelData{Type: "Air"}
-				}
+			height, biome := g.shapeTerrain(position, x, z)
+			height, river := g.carveRiver(position, x, z, height)
+
+			if g.World.Terrain == TerrainDensity {
+				// The height only biases the density, the real surface comes from the voxels
+				height = g.fillDensityColumn(column, position, x, z, height, biome, waterLevel)
+			} else {
+				fillColumn(column, x, z, height, biome, waterLevel)
+			}
+
+			column.HeightMap[x][z] = height
+			column.BiomeMap[x][z] = biome
+
+			snowCap(column, x, z, height, biome, g.World.SnowLevel())
+			g.coverSeaFloor(column, int(position.X)+x, int(position.Z)+z, x, z, height, biome)
+
+			// Caves are carved before the water, so only the open ones get flooded
+			g.carveCaves(column, position, x, z, height <= waterLevel || river.Bed)
+
+			if river.Level > 0 {
+				placeRiver(column, position, x, z, river, g.Sand)
 			}
 
 			// Add water to specific layer
-			genWaterFormations(chunk, x, z)
+			genWaterFormations(column, position, g.World.WaterLevel(), x, z, biome, g.Sand)
 
-			genClouds(chunk, position, x, z, p1)
+			genClouds(column, position, g.World.CloudHeight(), x, z, g.Clouds)
 		}
 	}
 
-	if rand.Float64() < 0.1 { //	10% chance of generationg cave in the chunk
-		genCaves(chunk, chunkCache, position, waterLevel, p1)
-	}
-
-	//  Generate the plants after the terrain generation
-	generatePlants(chunk, position, oldPlants, reusePlants)
+	// Minerals only replace the stone that is left after the caves
+	g.generateOres(column, coord)
 
-	generateTrees(chunk, chunkCache, position, oldTrees, reuseTrees)
+	// Each column places its own part of the structures around it
+	g.placeStructures(column, coord)
 
-	// Marks the chunk as outdated so that the mesh can be generated
-	chunk.IsOutdated = true
+	column.Stage = pkg.StageTerrain
 
-	return chunk
+	return column
 }
 
-// Perlin worms using 3D perlin noise
-func genCaves(chunk *pkg.Chunk, chunkCache *ChunkCache, chunkOrigin rl.Vector3, waterLevel int, p1 *perlin.Perlin) {
-	steps := 200 + rand.Intn(601)
-	freq := 0.08
-	radius := 2
-	x := rand.Intn(pkg.ChunkSize)
-	z := rand.Intn(pkg.ChunkSize)
+// Decoration stage: plants and trees. Trees can grow into the neighbors, so they must be
+// in chunkCache and have finished their terrain (or the parts that reach them are lost).
+// The caller holds the write lock of chunkCache.
+func (g *Generator) decorate(column *pkg.Column, chunkCache *ChunkCache) {
+	coord := pkg.Coords{X: column.X, Z: column.Z}
+	position := ChunkOrigin(coord)
+	rng := chunkRand(g.Seed, coord)
+
+	// A column that was generated again must not grow its trees a second time into the
+	// neighbors that already have them: the player may have cut them since
+	into := map[*pkg.Column]bool{column: true}
+	for dx := -1; dx <= 1; dx++ {
+		for dz := -1; dz <= 1; dz++ {
+			neighbor := chunkCache.Columns[pkg.Coords{X: coord.X + dx, Z: coord.Z + dz}]
+			if neighbor != nil && neighbor != column && neighbor.TreesFrom&neighborBit(-dx, -dz) == 0 {
+				into[neighbor] = true
+				neighbor.TreesFrom |= neighborBit(-dx, -dz)
+			}
+		}
+	}
 
-	// find the surface
-	surface := chunk.HeightMap[x][z]
+	generatePlants(column, position, g.World.WaterLevel(), rng)
+	g.generateTrees(column, chunkCache, position, g.World.WaterLevel(), rng, into)
 
-	if surface <= waterLevel {
-		return //	Don't create caves next to waterBodies
+	// And the trees of the neighbors that were decorated before this column was generated (again)
+	for dx := -1; dx <= 1; dx++ {
+		for dz := -1; dz <= 1; dz++ {
+			neighbor := chunkCache.Columns[pkg.Coords{X: coord.X + dx, Z: coord.Z + dz}]
+			if neighbor != nil && neighbor != column && neighbor.Stage >= pkg.StageDecorated && column.TreesFrom&neighborBit(dx, dz) == 0 {
+				g.replayTrees(chunkCache, neighbor, column)
+				column.TreesFrom |= neighborBit(dx, dz)
+			}
+		}
 	}
 
-	pos := rl.NewVector3(chunkOrigin.X+float32(x), float32(surface), chunkOrigin.Z+float32(z))
+	column.Stage = pkg.StageDecorated
+}
 
-	for step := 0; step < steps; step++ {
-		// direction guided by the perlin
-		dx := float32(p1.Noise3D(float64(pos.X)*freq, float64(pos.Y)*freq, float64(pos.Z)*freq))
-		dy := float32(p1.Noise3D(float64(pos.X)*freq+100, float64(pos.Y)*freq+100, float64(pos.Z)*freq+100))
-		dz := float32(p1.Noise3D(float64(pos.X)*freq+200, float64(pos.Y)*freq+200, float64(pos.Z)*freq+200))
+// Bit of pkg.Column.TreesFrom for the neighbor at dx, dz
+func neighborBit(dx, dz int) uint16 {
+	return 1 << ((dx+1)*3 + dz + 1)
+}
 
-		dir := rl.Vector3{dx, dy, dz}
-		// normalize
-		length := float32(math.Sqrt(float64(dx*dx + dy*dy + dz*dz)))
-		dir = rl.Vector3{dx / length, dy / length, dz / length}
+// Last stage, once nothing else will be written into the column by the generation
+func finalize(column *pkg.Column) {
+	// Caves can leave chunks with nothing but air
+	column.Compact()
 
-		// advance
-		pos = rl.Vector3{pos.X + dir.X, pos.Y + dir.Y, pos.Z + dir.Z}
+	// Marks the chunks as outdated so that their meshes can be generated
+	for _, chunk := range column.Sections {
+		if chunk != nil {
+			chunk.NeedsRemesh = true
+		}
+	}
+	column.Stage = pkg.StageFinal
+}
 
-		// depth limit
-		if pos.Y <= 2 {
-			break
+// Fills a column solid up to its height
+func fillColumn(column *pkg.Column, x, z, height int, biome pkg.BiomeProperties, waterLevel int) {
+	// Everything above the surface is already air, chunks only get created where there is something
+	for y := column.MinY(); y <= height; y++ {
+		if !column.Set(x, y, z, layerVoxel(biome, height-y, y > waterLevel)) {
+			break // above the top of the world
 		}
+	}
+}
 
-		// convert to local chunk
-		coord := ToChunkCoord(pos)
-		localX := int(pos.X) - coord.X*pkg.ChunkSize
-		localY := int(pos.Y)
-		localZ := int(pos.Z) - coord.Z*pkg.ChunkSize
+// High surfaces are covered by snow whatever the biome
+func snowCap(column *pkg.Column, x, z, height int, biome pkg.BiomeProperties, snowLevel int) {
+	if height >= snowLevel && column.Get(x, height, z).Type == Blocks.ID(biome.SurfaceBlock) {
+		column.Set(x, height, z, voxelOf("Snow"))
+	}
+}
 
-		// check if the chunk exists
-		chunkCache.CacheMutex.RLock()
-		targetChunk := chunkCache.Active[coord]
-		chunkCache.CacheMutex.RUnlock()
+// How far (in blocks) the density can move the surface up or down
+const densityStrength = 24.0
 
-		if targetChunk != nil {
-			if localX >= 0 && localX < pkg.ChunkSize &&
-				localY >= 0 && localY < pkg.WorldHeight &&
-				localZ >= 0 && localZ < pkg.ChunkSize {
-				if targetChunk.Voxels[localX][localY][localZ].Type == "Water" {
-					break
-				}
+// Fills a column where the density is positive. The density is the distance to the height of shapeTerrain
+// (so it carries the biome modifier) disturbed by 3D noise, which gives overhangs, cliffs and arches.
+// Returns the highest solid voxel, used as the height map from then on.
+func (g *Generator) fillDensityColumn(column *pkg.Column, position rl.Vector3, x, z, height int, biome pkg.BiomeProperties, waterLevel int) int {
+	gx := float64(int(position.X) + x)
+	gz := float64(int(position.Z) + z)
 
-				dynamicRadius := radius + rand.Intn(2) // 2 or 3
+	top := min(height+int(densityStrength), column.MaxY()-1)
+	surface := column.MinY() - 1
+	depth := -1 // solid voxels since the last air, going down
 
-				carveSphere(targetChunk, localX, localY, localZ, dynamicRadius)
-			}
-		} else {
-			chunkCache.CacheMutex.Lock()
-			chunkCache.PendingVoxels[coord] = append(chunkCache.PendingVoxels[coord],
-				PendingWrite{
-					Pos:   [3]int{localX, localY, localZ},
-					Voxel: pkg.VoxelData{Type: "Air"},
-				})
-			chunkCache.CacheMutex.Unlock()
+	for y := top; y >= column.MinY(); y-- {
+		density := float64(height - y)
+		if math.Abs(density) < densityStrength {
+			density += g.Density.Noise3D(gx, float64(y), gz) * densityStrength
+		}
+
+		if density <= 0 {
+			depth = -1
+			continue
 		}
+
+		depth++
+		if surface < column.MinY() {
+			surface = y
+		}
+		// The surface block only goes on top, the bottom of overhangs is underground
+		column.Set(x, y, z, layerVoxel(biome, depth, y > waterLevel))
 	}
+	return surface
 }
 
-// Function to carve an air sphere (tunnel)
-func carveSphere(chunk *pkg.Chunk, cx, cy, cz, radius int) {
-	for x := cx - radius; x <= cx+radius; x++ {
-		for y := cy - radius; y <= cy+radius; y++ {
-			for z := cz - radius; z <= cz+radius; z++ {
-				if x >= 0 && x < pkg.ChunkSize &&
-					y >= 0 && y < pkg.WorldHeight &&
-					z >= 0 && z < pkg.ChunkSize {
-					dx, dy, dz := x-cx, y-cy, z-cz
-					if chunk.Voxels[x][y][z].Type == "Water" {
-						return
-					} else if dx*dx+dy*dy+dz*dz <= radius*radius {
-						chunk.Voxels[x][y][z] = pkg.VoxelData{Type: "Air"}
-					}
-				}
-			}
+// Block of a solid voxel at some depth below the air above it
+func layerVoxel(biome pkg.BiomeProperties, depth int, aboveWater bool) pkg.VoxelData {
+	switch {
+	case depth == 0 && aboveWater:
+		return pkg.VoxelData{
+			Type:  Blocks.ID(biome.SurfaceBlock),
+			Color: biome.GrassColor,
 		}
+	case depth > biome.FillerDepth:
+		return voxelOf("Stone")
 	}
+	return pkg.VoxelData{Type: Blocks.ID(biome.UndergroundBlock)}
 }
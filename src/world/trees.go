@@ -0,0 +1,316 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/rand"
+
+	"go-engine/assets"
+	"go-engine/src/lsystem"
+	"go-engine/src/noise"
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Every tree species, loaded from assets/data/trees.json
+var Trees = mustLoadDefaultTrees()
+
+// Canopy shapes
+const (
+	CanopySphere   = "sphere"
+	CanopyCone     = "cone"     // wide at the bottom, for conifers (the leaves hang below the L)
+	CanopyUmbrella = "umbrella" // flat and wide, like acacias
+	CanopyBlob     = "blob"     // sphere deformed by noise
+)
+
+// Tree species as it is written in the data file
+type speciesDefinition struct {
+	Name        string     `json:"name"`
+	Trunk       string     `json:"trunk"`
+	Leaves      string     `json:"leaves"`
+	LeavesColor [4]uint8   `json:"leavesColor"` // missing: the leaves color of the biome
+	Canopy      string     `json:"canopy"`
+	Height      [2]float64 `json:"height"`     // range of h in the axiom
+	CanopySize  [2]float64 `json:"canopySize"` // range of the radius of L without a parameter
+
+	// L-system
+	Axiom      string  `json:"axiom"` // can use h, the trunk height
+	Iterations int     `json:"iterations"`
+	Angle      float64 `json:"angle"`  // degrees, for the turns without a parameter
+	Width      float64 `json:"width"`  // trunk radius, 0.5 is one voxel
+	Length     float64 `json:"length"` // for the F without a parameter
+	Rules      []struct {
+		Rule   string  `json:"rule"`
+		Weight float64 `json:"weight"` // 1 when missing
+	} `json:"rules"`
+}
+
+type TreeRegistry struct {
+	species []*pkg.TreeSpecies
+	byName  map[string]*pkg.TreeSpecies
+}
+
+func mustLoadDefaultTrees() *TreeRegistry {
+	registry, err := LoadTreeRegistry(assets.Data, "data/trees.json")
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// Loads the tree species. The blocks they use must already be in Blocks.
+func LoadTreeRegistry(fsys fs.FS, path string) (*TreeRegistry, error) {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Trees []speciesDefinition `json:"trees"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	registry := &TreeRegistry{byName: make(map[string]*pkg.TreeSpecies)}
+	for _, def := range file.Trees {
+		if _, ok := registry.byName[def.Name]; ok {
+			return nil, fmt.Errorf("%s: tree %q is defined twice", path, def.Name)
+		}
+		species, err := def.toSpecies()
+		if err != nil {
+			return nil, fmt.Errorf("%s: tree %q: %w", path, def.Name, err)
+		}
+		registry.species = append(registry.species, species)
+		registry.byName[def.Name] = species
+	}
+	return registry, nil
+}
+
+func (def speciesDefinition) toSpecies() (*pkg.TreeSpecies, error) {
+	trunk, ok := Blocks.Lookup(def.Trunk)
+	if !ok {
+		return nil, fmt.Errorf("unknown trunk block %q", def.Trunk)
+	}
+	leaves, ok := Blocks.Lookup(def.Leaves)
+	if !ok {
+		return nil, fmt.Errorf("unknown leaves block %q", def.Leaves)
+	}
+
+	canopy := def.Canopy
+	switch canopy {
+	case CanopySphere, CanopyCone, CanopyUmbrella, CanopyBlob:
+	case "":
+		canopy = CanopySphere
+	default:
+		return nil, fmt.Errorf("unknown canopy shape %q", def.Canopy)
+	}
+
+	if def.Height[0] > def.Height[1] || def.CanopySize[0] > def.CanopySize[1] {
+		return nil, fmt.Errorf("height and canopy size must be [min, max]")
+	}
+	canopySize := def.CanopySize
+	if canopySize == [2]float64{} {
+		canopySize = [2]float64{2, 2}
+	}
+
+	axiom, err := lsystem.ParsePattern(def.Axiom, "h")
+	if err != nil {
+		return nil, fmt.Errorf("axiom %q: %w", def.Axiom, err)
+	}
+	if len(axiom.Modules()) == 0 {
+		return nil, fmt.Errorf("no axiom")
+	}
+	if def.Iterations < 0 {
+		return nil, fmt.Errorf("negative iterations")
+	}
+
+	species := &pkg.TreeSpecies{
+		Name:        def.Name,
+		Trunk:       trunk,
+		Leaves:      leaves,
+		LeavesColor: rl.NewColor(def.LeavesColor[0], def.LeavesColor[1], def.LeavesColor[2], def.LeavesColor[3]),
+		Canopy:      canopy,
+		Height:      def.Height,
+		CanopySize:  canopySize,
+		Axiom:       axiom,
+		Growth: lsystem.System{
+			Iterations: def.Iterations,
+			Angle:      def.Angle,
+			Width:      def.Width,
+			Length:     def.Length,
+		},
+	}
+	if species.Growth.Width == 0 {
+		species.Growth.Width = 0.5
+	}
+
+	for _, r := range def.Rules {
+		weight := r.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		rule, err := lsystem.ParseRule(r.Rule, weight)
+		if err != nil {
+			return nil, err
+		}
+		species.Growth.Rules = append(species.Growth.Rules, rule)
+	}
+	return species, nil
+}
+
+func (r *TreeRegistry) Get(name string) (*pkg.TreeSpecies, bool) {
+	species, ok := r.byName[name]
+	return species, ok
+}
+
+// Every species, in the order of the data file
+func (r *TreeRegistry) All() []*pkg.TreeSpecies {
+	return r.species
+}
+
+func between(limits [2]float64, rng *rand.Rand) float64 {
+	return limits[0] + rng.Float64()*(limits[1]-limits[0])
+}
+
+// Grows a tree of a species. The result holds every parameter (trunk width, turn angles,
+// canopy sizes and a random heading), so it draws the same tree without the L-system.
+func growTree(species *pkg.TreeSpecies, rng *rand.Rand) string {
+	system := species.Growth
+	system.Axiom = species.Axiom.Modules(math.Round(between(species.Height, rng)))
+	canopy := between(species.CanopySize, rng)
+
+	start := []lsystem.Module{
+		{Symbol: '!', Params: []float64{system.Width}},
+		{Symbol: '/', Params: []float64{rng.Float64() * 360}},
+	}
+	modules := system.Resolve(append(start, system.Expand(rng)...))
+
+	for i, m := range modules {
+		if m.Symbol == 'L' && len(m.Params) == 0 {
+			modules[i].Params = []float64{canopy}
+		}
+	}
+	return lsystem.Format(modules)
+}
+
+// Writes the branches and leaves drawn by the turtle into the world. It runs in the decoration
+// stage, which holds the write lock of the chunk cache.
+type treeBuilder struct {
+	chunkCache *ChunkCache
+	wood       pkg.VoxelData
+	leaves     pkg.VoxelData
+	canopy     string
+	trunk      map[[3]int]bool // the leaves don't replace the tree's own wood
+	rng        *rand.Rand
+	blob       noise.Source
+	into       map[*pkg.Column]bool // when set, the other columns are left alone
+}
+
+// Trees grow through air, plants and leaves, but never into the ground or other solid blocks
+func (b *treeBuilder) set(x, y, z int, voxel pkg.VoxelData) {
+	pos := rl.NewVector3(float32(x), float32(y), float32(z))
+	if column, _, _, _ := b.chunkCache.locate(pos); b.into != nil && !b.into[column] {
+		return
+	}
+	current := b.chunkCache.voxel(pos)
+	if !Blocks.Get(current.Type).IsReplaceable && current.Type != b.leaves.Type {
+		return
+	}
+	// Where two canopies meet, the leaves with the larger color win. It doesn't depend on which
+	// tree grew first, so the columns can be decorated in any order.
+	if voxel.Type == b.leaves.Type && current.Type == b.leaves.Type && packColor(voxel.Color) <= packColor(current.Color) {
+		return
+	}
+	b.chunkCache.setVoxel(pos, voxel)
+}
+
+func packColor(c rl.Color) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+func (b *treeBuilder) Branch(from, to lsystem.Vec3, width float64) {
+	d := lsystem.Vec3{X: to.X - from.X, Y: to.Y - from.Y, Z: to.Z - from.Z}
+	steps := int(math.Ceil(math.Sqrt(d.Dot(d))*2)) + 1
+	r := int(math.Ceil(width - 0.5))
+
+	for i := range steps {
+		p := from.Add(d.Scale(float64(i) / float64(steps)))
+		cx, cy, cz := int(math.Floor(p.X)), int(math.Floor(p.Y)), int(math.Floor(p.Z))
+
+		// Thick branches are spheres along the segment
+		for dx := -r; dx <= r; dx++ {
+			for dy := -r; dy <= r; dy++ {
+				for dz := -r; dz <= r; dz++ {
+					if float64(dx*dx+dy*dy+dz*dz) > width*width {
+						continue
+					}
+					pos := [3]int{cx + dx, cy + dy, cz + dz}
+					if !b.trunk[pos] {
+						b.trunk[pos] = true
+						b.set(pos[0], pos[1], pos[2], b.wood)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (b *treeBuilder) Leaves(at lsystem.Vec3, radius float64) {
+	r := int(math.Ceil(radius))
+	cx, cy, cz := int(math.Floor(at.X)), int(math.Floor(at.Y)), int(math.Floor(at.Z))
+
+	// Vertical extent of the canopy around the L
+	bottom, top := -r, r
+	switch b.canopy {
+	case CanopyCone:
+		bottom, top = -2*r-1, 1
+	case CanopyUmbrella:
+		bottom, top = 0, 1
+	}
+
+	for dy := bottom; dy <= top; dy++ {
+		for dx := -r; dx <= r; dx++ {
+			for dz := -r; dz <= r; dz++ {
+				if !b.inCanopy(dx, dy, dz, cx, cy, cz, radius, bottom, top) {
+					continue
+				}
+				pos := [3]int{cx + dx, cy + dy, cz + dz}
+				if !b.trunk[pos] {
+					b.set(pos[0], pos[1], pos[2], b.leaves)
+				}
+			}
+		}
+	}
+}
+
+func (b *treeBuilder) inCanopy(dx, dy, dz, cx, cy, cz int, radius float64, bottom, top int) bool {
+	// Ragged edges, so the canopies don't look carved by a compass
+	edge := 0.5 - b.rng.Float64()*0.8
+	horizontal := float64(dx*dx + dz*dz)
+
+	switch b.canopy {
+	case CanopyCone:
+		// The radius shrinks to the top
+		level := radius * float64(top-dy) / float64(top-bottom)
+		return horizontal <= (level+edge)*(level+edge)
+
+	case CanopyUmbrella:
+		level := radius
+		if dy == top {
+			level = radius - 1 // rounded top
+		}
+		return horizontal <= (level+edge)*(level+edge)
+
+	case CanopyBlob:
+		n := b.blob.Noise3D(float64(cx+dx)*0.35, float64(cy+dy)*0.35, float64(cz+dz)*0.35)
+		limit := radius * (1 + 0.45*n)
+		return horizontal+float64(dy*dy) <= (limit+edge)*(limit+edge)
+
+	default:
+		return horizontal+float64(dy*dy) <= (radius+edge)*(radius+edge)
+	}
+}
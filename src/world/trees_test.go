@@ -0,0 +1,144 @@
+package world
+
+import (
+	"math/rand"
+	"testing"
+	"testing/fstest"
+
+	"go-engine/src/lsystem"
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+type treeCounter struct {
+	branches, leaves int
+}
+
+func (c *treeCounter) Branch(from, to lsystem.Vec3, width float64) { c.branches++ }
+func (c *treeCounter) Leaves(at lsystem.Vec3, radius float64)      { c.leaves++ }
+
+func TestTreeSpeciesGrow(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+
+	for _, species := range Trees.All() {
+		tree := growTree(species, rng)
+
+		// The grown string draws on its own, like the trees rebuilt from the cache
+		modules, err := lsystem.Parse(tree)
+		if err != nil {
+			t.Fatalf("%s: %v", species.Name, err)
+		}
+		counter := &treeCounter{}
+		(&lsystem.System{}).Draw(modules, lsystem.NewTurtle(lsystem.Vec3{}, 0.5, 0), counter)
+
+		if counter.branches == 0 || counter.leaves == 0 {
+			t.Errorf("%s has %d branches and %d leaves: %s", species.Name, counter.branches, counter.leaves, tree)
+		}
+	}
+}
+
+func TestTreesAreNotIdentical(t *testing.T) {
+	oak, _ := Trees.Get("Oak")
+	system := oak.Growth
+	system.Axiom = oak.Axiom.Modules(3)
+	rng := rand.New(rand.NewSource(1))
+
+	trees := make(map[string]bool)
+	for range 10 {
+		trees[lsystem.Format(system.Expand(rng))] = true
+	}
+	if len(trees) < 3 {
+		t.Errorf("only %d different trees out of 10", len(trees))
+	}
+}
+
+// Birchwood must grow birches, with their own wood
+func TestBirchwoodHasBirches(t *testing.T) {
+	gen := NewGenerator(8, DefaultSettings)
+	birch := Blocks.ID("BirchWood")
+
+	// Biomes are large, every third column is enough to find one
+	for x := 0; x < 300; x += 3 {
+		for z := 0; z < 300; z += 3 {
+			origin := rl.NewVector3(float32(x*pkg.ChunkSize), 0, float32(z*pkg.ChunkSize))
+			if _, biome := gen.shapeTerrain(origin, 8, 8); biome.Name != "Birchwood" {
+				continue
+			}
+
+			column := gen.Generate(pkg.Coords{X: x, Z: z})
+			for _, tree := range column.Trees {
+				if tree.Species != "Birch" {
+					continue
+				}
+				pos := tree.Position
+				if column.Get(int(pos.X)-x*pkg.ChunkSize, int(pos.Y), int(pos.Z)-z*pkg.ChunkSize).Type != birch {
+					t.Fatalf("birch at %v has no birch wood", pos)
+				}
+				return
+			}
+		}
+	}
+	t.Fatal("no birch was found in Birchwood")
+}
+
+func TestTreeSpeciesErrors(t *testing.T) {
+	files := map[string]string{
+		"unknown trunk":   `{"trees": [{"name": "A", "trunk": "Marble", "leaves": "Leaves", "axiom": "F(h)"}]}`,
+		"unknown leaves":  `{"trees": [{"name": "A", "trunk": "OakWood", "leaves": "Marble", "axiom": "F(h)"}]}`,
+		"unknown canopy":  `{"trees": [{"name": "A", "trunk": "OakWood", "leaves": "Leaves", "canopy": "cube", "axiom": "F(h)"}]}`,
+		"no axiom":        `{"trees": [{"name": "A", "trunk": "OakWood", "leaves": "Leaves"}]}`,
+		"bad axiom":       `{"trees": [{"name": "A", "trunk": "OakWood", "leaves": "Leaves", "axiom": "F(x)"}]}`,
+		"bad range":       `{"trees": [{"name": "A", "trunk": "OakWood", "leaves": "Leaves", "axiom": "F(h)", "height": [5, 2]}]}`,
+		"bad canopy size": `{"trees": [{"name": "A", "trunk": "OakWood", "leaves": "Leaves", "axiom": "F(h)", "canopySize": [4, 1]}]}`,
+		"bad rule":        `{"trees": [{"name": "A", "trunk": "OakWood", "leaves": "Leaves", "axiom": "A", "rules": [{"rule": "A=F("}]}]}`,
+		"iterations":      `{"trees": [{"name": "A", "trunk": "OakWood", "leaves": "Leaves", "axiom": "F", "iterations": -1}]}`,
+		"twice":           `{"trees": [{"name": "A", "trunk": "OakWood", "leaves": "Leaves", "axiom": "F"}, {"name": "A", "trunk": "OakWood", "leaves": "Leaves", "axiom": "F"}]}`,
+	}
+
+	for name, data := range files {
+		fsys := fstest.MapFS{"trees.json": {Data: []byte(data)}}
+		if _, err := LoadTreeRegistry(fsys, "trees.json"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestTreeSpeciesDefaults(t *testing.T) {
+	def := speciesDefinition{Name: "A", Trunk: "OakWood", Leaves: "Leaves", Axiom: "F(h)L"}
+	species, err := def.toSpecies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if species.Canopy != CanopySphere || species.CanopySize != [2]float64{2, 2} || species.Growth.Width != 0.5 {
+		t.Errorf("defaults are canopy %q, size %v and width %v", species.Canopy, species.CanopySize, species.Growth.Width)
+	}
+	if def.Canopy != "" || def.CanopySize != [2]float64{} {
+		t.Error("the defaults were written into the definition")
+	}
+}
+
+func TestTreeLeavesDependOnTheSeed(t *testing.T) {
+	species, ok := Trees.Get("BigOak")
+	if !ok {
+		t.Fatal("no BigOak species")
+	}
+	biome, _ := Biomes.Get("Meadow")
+	structure := growTree(species, rand.New(rand.NewSource(1)))
+
+	// The same tree on empty ground, with the world seed as the only difference
+	place := func(seed int64) *pkg.Column {
+		gen := NewGenerator(seed, DefaultSettings)
+		cache := NewChunkCache()
+		column := cache.add(pkg.NewColumn(0, 0, gen.World.MinSection(), gen.World.Sections()))
+		gen.placeTree(cache, rl.NewVector3(8, 40, 8), structure, species, *biome, nil)
+		return column
+	}
+
+	if !sameVoxels(place(1), place(1)) {
+		t.Error("the same seed placed different leaves")
+	}
+	if sameVoxels(place(1), place(2)) {
+		t.Error("every world places the same leaves at the same position")
+	}
+}
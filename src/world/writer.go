@@ -0,0 +1,146 @@
+package world
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-engine/src/pkg"
+)
+
+// Columns that failed to save are tried again after this long
+const saveRetryDelay = 5 * time.Second
+
+// Saves the columns that unload on a goroutine of its own, so the compression and the disk
+// never hold back a frame. An unloaded column belongs to the writer from then on: nothing else
+// changes it, the writer moves its chunks to their last state once it is on disk.
+// A column that fails to save stays queued and is tried again, its chunks stay unloading until then.
+type columnWriter struct {
+	cache   *ChunkCache
+	mutex   sync.Mutex
+	wake    *sync.Cond                 // signals the goroutine that there are columns to write or that it closed
+	pending map[pkg.Coords]*pkg.Column // waiting or being written, the latest version of each coordinate
+	failed  map[*pkg.Column]time.Time  // columns that failed to save, and when to try them again
+	writing *pkg.Column                // the column being written
+	closed  bool
+	done    chan struct{} // closed when the goroutine returns
+}
+
+func newColumnWriter(cache *ChunkCache) *columnWriter {
+	w := &columnWriter{
+		cache:   cache,
+		pending: make(map[pkg.Coords]*pkg.Column),
+		failed:  make(map[*pkg.Column]time.Time),
+		done:    make(chan struct{}),
+	}
+	w.wake = sync.NewCond(&w.mutex)
+	go w.run()
+	return w
+}
+
+// Queues an unloaded column. A version of the same coordinate that is still waiting is replaced,
+// the new one was loaded from it.
+func (w *columnWriter) Queue(coord pkg.Coords, column *pkg.Column) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if old := w.pending[coord]; old != nil && old != w.writing {
+		delete(w.failed, old)
+		w.cache.discard(chunksOf(old)...)
+	}
+	w.pending[coord] = column
+	w.wake.Broadcast()
+}
+
+// Copy of a column that is waiting to be written, nil if there is none. The copy is dirty:
+// it may be loaded again before the writer is done with the original.
+func (w *columnWriter) Unsaved(coord pkg.Coords, settings Settings) *pkg.Column {
+	w.mutex.Lock()
+	column := w.pending[coord]
+	w.mutex.Unlock()
+	if column == nil {
+		return nil
+	}
+
+	// Only read here and by the writer, so the copy can be made without the lock
+	copied, err := newColumnRecord(column).toColumn(coord, settings)
+	if err != nil {
+		fmt.Printf("Failed to copy column %v: %v\n", coord, err)
+		return nil
+	}
+	copied.IsDirty = true
+	return copied
+}
+
+// Writes the queued columns and stops the goroutine. The columns that fail again are lost.
+func (w *columnWriter) Close() {
+	w.mutex.Lock()
+	w.closed = true
+	w.wake.Broadcast()
+	w.mutex.Unlock()
+	<-w.done
+}
+
+func (w *columnWriter) run() {
+	defer close(w.done)
+	for {
+		coord, column, ok := w.next()
+		if !ok {
+			return
+		}
+
+		err := w.cache.Store.Save(coord, column)
+
+		w.mutex.Lock()
+		w.writing = nil
+		current := w.pending[coord] == column
+		switch {
+		case err == nil:
+			for _, chunk := range chunksOf(column) {
+				w.cache.Transition(chunk, pkg.ChunkSaved)
+			}
+		case !current:
+			// A newer version is written next, it has the same changes
+			w.cache.discard(chunksOf(column)...)
+		case w.closed || errors.Is(err, errOtherVersion):
+			fmt.Printf("Failed to save column %v, its changes are lost: %v\n", coord, err)
+			w.cache.discard(chunksOf(column)...)
+		default:
+			fmt.Printf("Failed to save column %v, trying again in %v: %v\n", coord, saveRetryDelay, err)
+			w.failed[column] = time.Now().Add(saveRetryDelay)
+			time.AfterFunc(saveRetryDelay, func() {
+				w.mutex.Lock()
+				w.wake.Broadcast()
+				w.mutex.Unlock()
+			})
+			w.mutex.Unlock()
+			continue
+		}
+		if current {
+			delete(w.pending, coord)
+		}
+		delete(w.failed, column)
+		w.mutex.Unlock()
+	}
+}
+
+// Column to write next, false once the writer is closed and has nothing left.
+// Once it is closed, the columns that failed are tried one last time right away.
+func (w *columnWriter) next() (pkg.Coords, *pkg.Column, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for {
+		now := time.Now()
+		for coord, column := range w.pending {
+			if retry, failed := w.failed[column]; !failed || w.closed || !now.Before(retry) {
+				w.writing = column
+				return coord, column, true
+			}
+		}
+		if w.closed && len(w.pending) == 0 {
+			return pkg.Coords{}, nil, false
+		}
+		w.wake.Wait()
+	}
+}
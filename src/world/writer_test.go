@@ -0,0 +1,62 @@
+package world
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-engine/src/pkg"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestFailedSavesAreTriedAgain(t *testing.T) {
+	gen := NewGenerator(42, DefaultSettings)
+	cache := NewChunkCache()
+	center := pkg.Coords{X: 0, Z: 0}
+	buildAround(t, gen, cache, center, 2)
+
+	// A file where the region directory should be, so the saves fail
+	dir := filepath.Join(t.TempDir(), "regions")
+	if err := os.WriteFile(dir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache.Store = NewRegionStore(dir)
+
+	column := cache.Columns[center]
+	y := column.HeightMap[8][8] + 1
+	setVoxelGlobal(cache, rl.NewVector3(8, float32(y), 8), voxelOf("Stone"))
+	cache.CleanUp(rl.NewVector3(10000, 60, 10000))
+
+	// The writer keeps the column until it is saved
+	for failed := 0; failed == 0; {
+		time.Sleep(time.Millisecond)
+		cache.writer.mutex.Lock()
+		failed = len(cache.writer.failed)
+		cache.writer.mutex.Unlock()
+	}
+	copied := cache.writer.Unsaved(center, gen.World)
+	if copied == nil || copied.Get(8, y, 8) != voxelOf("Stone") || !copied.IsDirty {
+		t.Fatal("the column that failed to save can't be loaded again with its edit")
+	}
+	for _, chunk := range chunksOf(column) {
+		if chunk.State != pkg.ChunkUnloading {
+			t.Fatalf("chunk %v is %v although its column wasn't saved", chunk.Coord, chunk.State)
+		}
+	}
+
+	// Once the directory can be created, closing tries it again
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	cache.SaveAll()
+	for _, chunk := range chunksOf(column) {
+		if chunk.State != pkg.ChunkSaved {
+			t.Errorf("chunk %v is %v after its column was saved", chunk.Coord, chunk.State)
+		}
+	}
+	if saved, err := cache.Store.Load(center, gen.World); saved == nil || saved.Get(8, y, 8) != voxelOf("Stone") {
+		t.Errorf("the column wasn't saved with the edit (%v)", err)
+	}
+}